@@ -2,7 +2,10 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
+	"math/big"
 	"strings"
+	"unicode"
 
 	tk "github.com/seblkma/go-himeji/token" // naming conflicts with go/token
 )
@@ -10,11 +13,13 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() tk.Position // where the node starts in the source
 }
 
 type Statement interface {
 	Node
 	statementNode()
+	Comments() *tk.Trivia // the comments before the statement and after it on its last line
 }
 
 type Expression interface {
@@ -25,8 +30,17 @@ type Expression interface {
 // Program is a root Node holding all the statements
 type Program struct {
 	Statements []Statement
+	Comments   []tk.Comment // all the comments in the source, in order
 }
 
+// Commented is embedded in the statements to keep their comments, for formatters and documentation generators
+type Commented struct {
+	Trivia tk.Trivia
+}
+
+// Implements Statement
+func (c *Commented) Comments() *tk.Trivia { return &c.Trivia }
+
 // Implements the Node interface
 func (p *Program) TokenLiteral() string {
 	if len(p.Statements) > 0 {
@@ -35,6 +49,14 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+// Implements the Node interface
+func (p *Program) Pos() tk.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return tk.Position{}
+}
+
 // Implements the Note interface
 func (p *Program) String() string {
 	var out bytes.Buffer
@@ -47,6 +69,7 @@ func (p *Program) String() string {
 }
 
 type LetStatement struct {
+	Commented
 	Token tk.Token // token.LET
 	Name  *Identifier
 	Value Expression
@@ -58,6 +81,9 @@ func (ls *LetStatement) statementNode() {}
 // Implements Node
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 
+// Implements Node
+func (ls *LetStatement) Pos() tk.Position { return ls.Token.Pos }
+
 // Implements Node
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
@@ -74,7 +100,86 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// AssignStatement updates an existing binding, e.g. x = 1, or x += 1 which is x = x + 1
+type AssignStatement struct {
+	Commented
+	Token tk.Token // token.ASSIGN or a compound assignment, e.g. token.PLUS_ASSIGN
+	Name  *Identifier
+	Value Expression
+}
+
+// Implements Statement
+func (as *AssignStatement) statementNode() {}
+
+// Implements Node
+func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
+
+// Implements Node
+func (as *AssignStatement) Pos() tk.Position { return as.Name.Pos() }
+
+// Implements Node
+func (as *AssignStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(as.Name.String())
+	out.WriteString(" " + as.TokenLiteral() + " ")
+
+	if as.Value != nil {
+		out.WriteString(as.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// Operator returns the binary operator of a compound assignment, e.g. + for +=, "" for a plain assignment
+func (as *AssignStatement) Operator() string {
+	return compoundOperator(as.Token)
+}
+
+// IndexAssignStatement updates an array element or a hash value in place, e.g. arr[0] = 1, or h["k"] += 1
+type IndexAssignStatement struct {
+	Commented
+	Token  tk.Token // token.ASSIGN or a compound assignment, e.g. token.PLUS_ASSIGN
+	Target *IndexExpression
+	Value  Expression
+}
+
+// Implements Statement
+func (ias *IndexAssignStatement) statementNode() {}
+
+// Implements Node
+func (ias *IndexAssignStatement) TokenLiteral() string { return ias.Token.Literal }
+
+// Implements Node
+func (ias *IndexAssignStatement) Pos() tk.Position { return ias.Target.Pos() }
+
+// Implements Node
+func (ias *IndexAssignStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ias.Target.String())
+	out.WriteString(" " + ias.TokenLiteral() + " ")
+
+	if ias.Value != nil {
+		out.WriteString(ias.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// Operator returns the binary operator of a compound assignment, e.g. + for +=, "" for a plain assignment
+func (ias *IndexAssignStatement) Operator() string {
+	return compoundOperator(ias.Token)
+}
+
+func compoundOperator(assign tk.Token) string {
+	return strings.TrimSuffix(string(assign.Type), "=")
+}
+
 type ReturnStatement struct {
+	Commented
 	Token tk.Token // token.RETURN
 	Value Expression
 }
@@ -85,6 +190,9 @@ func (rs *ReturnStatement) statementNode() {}
 // Implements Node
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
 
+// Implements Node
+func (rs *ReturnStatement) Pos() tk.Position { return rs.Token.Pos }
+
 // Implements Node
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
@@ -100,7 +208,156 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// WhileStatement runs Body as long as Condition is truthy, e.g. while (i < 10) { i += 1 }
+type WhileStatement struct {
+	Commented
+	Token     tk.Token // token.WHILE
+	Condition Expression
+	Body      *BlockStatement
+}
+
+// Implements Statement
+func (ws *WhileStatement) statementNode() {}
+
+// Implements Node
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+
+// Implements Node
+func (ws *WhileStatement) Pos() tk.Position { return ws.Token.Pos }
+
+// Implements Node
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while (")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(") { ")
+	out.WriteString(ws.Body.String())
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// ForStatement is a C-style loop, e.g. for (let i = 0; i < 10; i += 1) { ... }
+// Init, Condition and Post are optional, a loop without a Condition runs until a break or a return.
+type ForStatement struct {
+	Commented
+	Token     tk.Token  // token.FOR
+	Init      Statement // runs once before the loop, its bindings are those of the enclosing scope
+	Condition Expression
+	Post      Statement // runs after the body and after a continue
+	Body      *BlockStatement
+}
+
+// Implements Statement
+func (fs *ForStatement) statementNode() {}
+
+// Implements Node
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+
+// Implements Node
+func (fs *ForStatement) Pos() tk.Position { return fs.Token.Pos }
+
+// Implements Node
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(strings.TrimSuffix(fs.Post.String(), ";"))
+	}
+	out.WriteString(") { ")
+	out.WriteString(fs.Body.String())
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// ForInStatement iterates over an array, a hash, a string or a range, e.g. for (x in arr) or for (k, v in hash).
+// Value is bound to each element, Key, if any, to its key, e.g. the index of an array element or the key of a hash value.
+// Like the init statement of a ForStatement, they are bound in the enclosing scope.
+type ForInStatement struct {
+	Commented
+	Token    tk.Token    // token.FOR
+	Key      *Identifier // nil for for (x in c)
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+// Implements Statement
+func (fis *ForInStatement) statementNode() {}
+
+// Implements Node
+func (fis *ForInStatement) TokenLiteral() string { return fis.Token.Literal }
+
+// Implements Node
+func (fis *ForInStatement) Pos() tk.Position { return fis.Token.Pos }
+
+// Implements Node
+func (fis *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fis.Key != nil {
+		out.WriteString(fis.Key.String() + ", ")
+	}
+	out.WriteString(fis.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fis.Iterable.String())
+	out.WriteString(") { ")
+	out.WriteString(fis.Body.String())
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// BreakStatement ends the innermost loop
+type BreakStatement struct {
+	Commented
+	Token tk.Token // token.BREAK
+}
+
+// Implements Statement
+func (bs *BreakStatement) statementNode() {}
+
+// Implements Node
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+
+// Implements Node
+func (bs *BreakStatement) Pos() tk.Position { return bs.Token.Pos }
+
+// Implements Node
+func (bs *BreakStatement) String() string { return bs.TokenLiteral() + ";" }
+
+// ContinueStatement goes on with the next iteration of the innermost loop
+type ContinueStatement struct {
+	Commented
+	Token tk.Token // token.CONTINUE
+}
+
+// Implements Statement
+func (cs *ContinueStatement) statementNode() {}
+
+// Implements Node
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+
+// Implements Node
+func (cs *ContinueStatement) Pos() tk.Position { return cs.Token.Pos }
+
+// Implements Node
+func (cs *ContinueStatement) String() string { return cs.TokenLiteral() + ";" }
+
 type ExpressionStatement struct {
+	Commented
 	Token      tk.Token // the first token of the expression
 	Expression Expression
 }
@@ -111,6 +368,9 @@ func (es *ExpressionStatement) statementNode() {}
 // Implements Node
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
 
+// Implements Node
+func (es *ExpressionStatement) Pos() tk.Position { return es.Token.Pos }
+
 // Implements Node
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
@@ -130,12 +390,18 @@ func (i *Identifier) expressionNode() {}
 // Implements Node
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 
+// Implements Node
+func (i *Identifier) Pos() tk.Position { return i.Token.Pos }
+
 // Implements Node
 func (i *Identifier) String() string { return i.Value }
 
+// IntegerLiteral is an integer, e.g. 42 or 0xFF. A literal out of the int64 range, e.g. 9223372036854775808,
+// is a BigInt: Big holds its value and Value is 0.
 type IntegerLiteral struct {
 	Token tk.Token // token.INT
 	Value int64
+	Big   *big.Int // nil if the value fits in int64
 }
 
 // Implements Expression
@@ -145,7 +411,47 @@ func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 
 // Implements Node
-func (il *IntegerLiteral) String() string { return il.Token.Literal } // Value is int64
+func (il *IntegerLiteral) Pos() tk.Position { return il.Token.Pos }
+
+// Implements Node
+func (il *IntegerLiteral) String() string { return il.Token.Literal }
+
+// FloatLiteral is a 64-bit floating-point number, e.g. 1.5 or 6.02e23
+type FloatLiteral struct {
+	Token tk.Token // token.FLOAT
+	Value float64
+}
+
+// Implements Expression
+func (fl *FloatLiteral) expressionNode() {}
+
+// Implements Node
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+
+// Implements Node
+func (fl *FloatLiteral) Pos() tk.Position { return fl.Token.Pos }
+
+// Implements Node
+func (fl *FloatLiteral) String() string { return fl.Token.Literal }
+
+// DecimalLiteral is an exact base-10 number, e.g. 12.50d is Unscaled 1250 with Scale 2
+type DecimalLiteral struct {
+	Token    tk.Token // token.DECIMAL
+	Unscaled *big.Int
+	Scale    int // digits after the decimal point, never negative
+}
+
+// Implements Expression
+func (dl *DecimalLiteral) expressionNode() {}
+
+// Implements Node
+func (dl *DecimalLiteral) TokenLiteral() string { return dl.Token.Literal }
+
+// Implements Node
+func (dl *DecimalLiteral) Pos() tk.Position { return dl.Token.Pos }
+
+// Implements Node
+func (dl *DecimalLiteral) String() string { return dl.Token.Literal }
 
 type PrefixExpression struct {
 	Token    tk.Token // e.g. !, +, -, ...
@@ -159,6 +465,9 @@ func (pe *PrefixExpression) expressionNode() {}
 // Implements Node
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
 
+// Implements Node
+func (pe *PrefixExpression) Pos() tk.Position { return pe.Token.Pos }
+
 // Implements Node
 func (pe PrefixExpression) String() string {
 	var out bytes.Buffer
@@ -182,6 +491,14 @@ func (ie *InfixExpression) expressionNode() {}
 // Implements Node
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
 
+// Implements Node
+func (ie *InfixExpression) Pos() tk.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos() // the operator token is not where the expression starts
+	}
+	return ie.Token.Pos
+}
+
 // Implements Node
 func (ie InfixExpression) String() string {
 	var out bytes.Buffer
@@ -204,12 +521,16 @@ func (b *Boolean) expressionNode() {}
 // Implements Node
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 
+// Implements Node
+func (b *Boolean) Pos() tk.Position { return b.Token.Pos }
+
 // Implements Node
 func (b *Boolean) String() string { return b.Token.Literal }
 
 type BlockStatement struct {
-	Token      tk.Token // the "{" token
-	Statements []Statement
+	Token       tk.Token // the "{" token
+	Statements  []Statement
+	EndComments []tk.Comment // the comments after the last statement, before the "}"
 }
 
 // Implements Expression
@@ -218,6 +539,9 @@ func (bs *BlockStatement) expressionNode() {}
 // Implements Node
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
 
+// Implements Node
+func (bs *BlockStatement) Pos() tk.Position { return bs.Token.Pos }
+
 // Implements Node
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
@@ -242,6 +566,9 @@ func (ife *IfExpression) expressionNode() {}
 // Implements Node
 func (ife *IfExpression) TokenLiteral() string { return ife.Token.Literal }
 
+// Implements Node
+func (ife *IfExpression) Pos() tk.Position { return ife.Token.Pos }
+
 // Implements Node
 func (ife *IfExpression) String() string {
 	var out bytes.Buffer
@@ -270,6 +597,9 @@ func (fnl *FunctionLiteral) expressionNode() {}
 // Implements Node
 func (fnl *FunctionLiteral) TokenLiteral() string { return fnl.Token.Literal }
 
+// Implements Node
+func (fnl *FunctionLiteral) Pos() tk.Position { return fnl.Token.Pos }
+
 // Implements Node
 func (fnl *FunctionLiteral) String() string {
 	var out bytes.Buffer
@@ -300,6 +630,14 @@ func (ce *CallExpression) expressionNode() {}
 // Implements Node
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
 
+// Implements Node
+func (ce *CallExpression) Pos() tk.Position {
+	if ce.Function != nil {
+		return ce.Function.Pos() // the operator token is not where the expression starts
+	}
+	return ce.Token.Pos
+}
+
 // Implements Node
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
@@ -329,7 +667,74 @@ func (sl *StringLiteral) expressionNode() {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 
 // Implements Node
-func (sl *StringLiteral) String() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() tk.Position { return sl.Token.Pos }
+
+// Implements Node, writes the value back as a "" literal, escaped the way the lexer decodes it
+func (sl *StringLiteral) String() string { return `"` + escape(sl.Value) + `"` }
+
+// InterpolatedString is a string with embedded expressions, e.g. "hello ${name}"
+type InterpolatedString struct {
+	Token tk.Token     // the token.STRING_HEAD token
+	Parts []Expression // *StringLiteral for the text between the ${...}, the expressions of the ${...}
+}
+
+// Implements Expression
+func (is *InterpolatedString) expressionNode() {}
+
+// Implements Node
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+
+// Implements Node
+func (is *InterpolatedString) Pos() tk.Position { return is.Token.Pos }
+
+// Implements Node
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(`"`)
+	for _, part := range is.Parts {
+		if text, ok := part.(*StringLiteral); ok {
+			out.WriteString(escape(text.Value))
+		} else {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+	out.WriteString(`"`)
+
+	return out.String()
+}
+
+// escape escapes the chars of s which cannot be written as they are in a "" literal
+func escape(s string) string {
+	var out strings.Builder
+
+	for i, ch := range s {
+		switch ch {
+		case '"', '\\':
+			out.WriteByte('\\')
+			out.WriteRune(ch)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '$':
+			if strings.HasPrefix(s[i:], "${") {
+				out.WriteByte('\\') // not an interpolation
+			}
+			out.WriteByte('$')
+		default:
+			if unicode.IsPrint(ch) {
+				out.WriteRune(ch)
+			} else {
+				fmt.Fprintf(&out, `\u{%X}`, ch)
+			}
+		}
+	}
+
+	return out.String()
+}
 
 type ArrayLiteral struct {
 	Token    tk.Token // the "[" token
@@ -342,6 +747,9 @@ func (al *ArrayLiteral) expressionNode() {}
 // Implements Node
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
 
+// Implements Node
+func (al *ArrayLiteral) Pos() tk.Position { return al.Token.Pos }
+
 // Implements Node
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
@@ -371,6 +779,14 @@ func (ie *IndexExpression) expressionNode() {}
 // Implements Node
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
 
+// Implements Node
+func (ie *IndexExpression) Pos() tk.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos() // the operator token is not where the expression starts
+	}
+	return ie.Token.Pos
+}
+
 // Implements Node
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
@@ -396,6 +812,9 @@ func (hl *HashLiteral) expressionNode() {}
 // Implements Node
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 
+// Implements Node
+func (hl *HashLiteral) Pos() tk.Position { return hl.Token.Pos }
+
 // Implements Node
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
@@ -411,3 +830,40 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// BadStatement is a placeholder for source that failed to parse as a statement,
+// from Token up to, but excluding, End. The parser has reported why.
+type BadStatement struct {
+	Commented
+	Token tk.Token // the first token of the statement
+	End   tk.Position
+}
+
+// Implements Statement
+func (bs *BadStatement) statementNode() {}
+
+// Implements Node
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+
+// Implements Node
+func (bs *BadStatement) Pos() tk.Position { return bs.Token.Pos }
+
+// Implements Node
+func (bs *BadStatement) String() string { return "<bad statement>" }
+
+// BadExpression is a placeholder for an expression that failed to parse, the parser has reported why.
+type BadExpression struct {
+	Token tk.Token // the token the expression was expected to start at
+}
+
+// Implements Expression
+func (be *BadExpression) expressionNode() {}
+
+// Implements Node
+func (be *BadExpression) TokenLiteral() string { return be.Token.Literal }
+
+// Implements Node
+func (be *BadExpression) Pos() tk.Position { return be.Token.Pos }
+
+// Implements Node
+func (be *BadExpression) String() string { return "<bad expression>" }
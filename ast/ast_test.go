@@ -31,3 +31,24 @@ func TestProgramString(t *testing.T) {
 	}
 
 }
+
+// GOFLAGS="-count=1" go test -run TestStringLiteralString
+func TestStringLiteralString(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"hello", `"hello"`},
+		{"say \"hi\"\n", `"say \"hi\"\n"`},
+		{"a\tb\\c\r", `"a\tb\\c\r"`},
+		{"日本 über", `"日本 über"`},
+		{"bell\a\u200b", `"bell\u{7}\u{200B}"`},
+	}
+
+	for _, tt := range tests {
+		lit := &StringLiteral{Token: tk.Token{Type: tk.STRING, Literal: tt.value}, Value: tt.value}
+		if lit.String() != tt.expected {
+			t.Errorf("wrong string. want=%s, got=%s", tt.expected, lit.String())
+		}
+	}
+}
@@ -0,0 +1,346 @@
+// Package bytecode reads and writes compiled himeji programs as .bin files.
+//
+// All integers are big-endian, like the operands in opcodes.Instructions.
+//
+//	header
+//	    magic               4 bytes  "HMJB"
+//	    format version      uint16   FormatVersion
+//	    opcode set version  uint16   opcodes.Version
+//	constant pool
+//	    count               uint32
+//	    constants           count times: tag byte, then the payload of the tag
+//	        TagInteger           int64
+//	        TagString            uint32 length, UTF-8 bytes
+//	        TagCompiledFunction  uint16 no. of locals, uint16 no. of parameters,
+//	                             uint32 length, instructions
+//	        TagFloat             IEEE 754 float64 bits
+//	        TagBigInt            sign byte 0 or 1 for negative, uint32 length, big-endian magnitude
+//	        TagDecimal           uint32 scale at most MaxDecimalScale, then the unscaled value as TagBigInt
+//	instructions
+//	    length              uint32
+//	    instructions        length bytes
+//
+// Nothing may follow the instructions section.
+package bytecode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/seblkma/go-himeji/compiler"
+	"github.com/seblkma/go-himeji/object"
+	"github.com/seblkma/go-himeji/opcodes"
+)
+
+const Magic = "HMJB"
+
+// FormatVersion is the version of the file layout, bump it whenever the layout changes.
+const FormatVersion = 1
+
+// Tags of the constants in the constant pool
+const (
+	TagInteger byte = iota + 1
+	TagString
+	TagCompiledFunction
+	TagFloat
+	TagBigInt
+	TagDecimal
+)
+
+// MaxDecimalScale bounds the scale of a decimal constant, decimal arithmetic computes 10^scale,
+// so a file with a scale of 4000000000 would exhaust the memory of the VM
+const MaxDecimalScale = object.MaxIntegerBits
+
+var (
+	ErrBadMagic           = errors.New("not a himeji bytecode file")
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	ErrTruncated          = errors.New("truncated file")
+	ErrMalformed          = errors.New("malformed file")
+)
+
+// Encode serializes bc into the .bin file format.
+func Encode(bc *compiler.ByteCode) ([]byte, error) {
+	var out bytes.Buffer
+
+	out.WriteString(Magic)
+	writeUint16(&out, FormatVersion)
+	writeUint16(&out, opcodes.Version)
+
+	writeUint32(&out, uint32(len(bc.Constants)))
+	for i, c := range bc.Constants {
+		err := encodeConstant(&out, c)
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+
+	writeBytes(&out, bc.Instructions)
+
+	return out.Bytes(), nil
+}
+
+func encodeConstant(out *bytes.Buffer, c object.Object) error {
+	switch c := c.(type) {
+	case *object.Integer:
+		out.WriteByte(TagInteger)
+		writeUint64(out, uint64(c.Value))
+	case *object.Float:
+		out.WriteByte(TagFloat)
+		writeUint64(out, math.Float64bits(c.Value))
+	case *object.BigInt:
+		out.WriteByte(TagBigInt)
+		writeBigInt(out, c.Value)
+	case *object.Decimal:
+		if c.Scale > MaxDecimalScale {
+			return fmt.Errorf("decimal scale too large: %d, at most %d", c.Scale, MaxDecimalScale)
+		}
+		out.WriteByte(TagDecimal)
+		writeUint32(out, uint32(c.Scale))
+		writeBigInt(out, c.Unscaled)
+	case *object.String:
+		out.WriteByte(TagString)
+		writeBytes(out, []byte(c.Value))
+	case *object.CompiledFunction:
+		if c.NumLocals > math.MaxUint16 || c.NumParameters > math.MaxUint16 {
+			return fmt.Errorf("too many locals or parameters: %d, %d", c.NumLocals, c.NumParameters)
+		}
+		out.WriteByte(TagCompiledFunction)
+		writeUint16(out, uint16(c.NumLocals))
+		writeUint16(out, uint16(c.NumParameters))
+		writeBytes(out, c.Instructions)
+	default:
+		return fmt.Errorf("cannot encode constant of type %s", c.Type())
+	}
+	return nil
+}
+
+func writeUint16(out *bytes.Buffer, v uint16) {
+	out.Write(binary.BigEndian.AppendUint16(nil, v))
+}
+
+func writeUint32(out *bytes.Buffer, v uint32) {
+	out.Write(binary.BigEndian.AppendUint32(nil, v))
+}
+
+func writeUint64(out *bytes.Buffer, v uint64) {
+	out.Write(binary.BigEndian.AppendUint64(nil, v))
+}
+
+// writeBytes writes b prefixed with its uint32 length
+func writeBytes(out *bytes.Buffer, b []byte) {
+	writeUint32(out, uint32(len(b)))
+	out.Write(b)
+}
+
+// writeBigInt writes the sign byte of v, then its magnitude prefixed with its uint32 length
+func writeBigInt(out *bytes.Buffer, v *big.Int) {
+	if v.Sign() < 0 {
+		out.WriteByte(1)
+	} else {
+		out.WriteByte(0)
+	}
+	writeBytes(out, v.Bytes())
+}
+
+// Decode deserializes a .bin file into the ByteCode to run on the VM.
+func Decode(data []byte) (*compiler.ByteCode, error) {
+	d := &decoder{data: data}
+
+	magic, err := d.read(len(Magic), "magic")
+	if err != nil {
+		return nil, err
+	}
+	if string(magic) != Magic {
+		return nil, ErrBadMagic
+	}
+
+	formatVersion, err := d.readUint16("format version")
+	if err != nil {
+		return nil, err
+	}
+	if formatVersion != FormatVersion {
+		return nil, fmt.Errorf("%w: format version %d, want %d", ErrUnsupportedVersion, formatVersion, FormatVersion)
+	}
+
+	// Opcodes are only ever added, files of an older opcode set still run
+	opcodesVersion, err := d.readUint16("opcode set version")
+	if err != nil {
+		return nil, err
+	}
+	if opcodesVersion > opcodes.Version {
+		return nil, fmt.Errorf("%w: opcode set version %d, want at most %d", ErrUnsupportedVersion, opcodesVersion, opcodes.Version)
+	}
+
+	count, err := d.readUint32("constant count")
+	if err != nil {
+		return nil, err
+	}
+
+	constants := []object.Object{}
+	for i := 0; i < int(count); i++ {
+		c, err := d.readConstant(i)
+		if err != nil {
+			return nil, err
+		}
+		constants = append(constants, c)
+	}
+
+	instructions, err := d.readBytes("instructions")
+	if err != nil {
+		return nil, err
+	}
+
+	if d.offset != len(d.data) {
+		return nil, fmt.Errorf("%w: %d trailing bytes after instructions", ErrMalformed, len(d.data)-d.offset)
+	}
+
+	return &compiler.ByteCode{Instructions: instructions, Constants: constants}, nil
+}
+
+// decoder reads the sections of a .bin file one after the other
+type decoder struct {
+	data   []byte
+	offset int // position of the next byte to read
+}
+
+func (d *decoder) read(n int, what string) ([]byte, error) {
+	if n < 0 || len(d.data)-d.offset < n {
+		return nil, fmt.Errorf("%w: reading %s at offset %d, need %d bytes, have %d", ErrTruncated, what, d.offset, n, len(d.data)-d.offset)
+	}
+	b := d.data[d.offset : d.offset+n]
+	d.offset += n
+	return b, nil
+}
+
+func (d *decoder) readUint16(what string) (uint16, error) {
+	b, err := d.read(2, what)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+func (d *decoder) readUint32(what string) (uint32, error) {
+	b, err := d.read(4, what)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func (d *decoder) readUint64(what string) (uint64, error) {
+	b, err := d.read(8, what)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// readBytes reads bytes prefixed with their uint32 length, the result is a copy
+func (d *decoder) readBytes(what string) ([]byte, error) {
+	n, err := d.readUint32(what + " length")
+	if err != nil {
+		return nil, err
+	}
+	if uint64(n) > uint64(len(d.data)-d.offset) {
+		return nil, fmt.Errorf("%w: reading %s at offset %d, need %d bytes, have %d", ErrTruncated, what, d.offset, n, len(d.data)-d.offset)
+	}
+	b, err := d.read(int(n), what)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, b...), nil
+}
+
+// readBigInt reads a sign byte, then a magnitude prefixed with its uint32 length
+func (d *decoder) readBigInt(what string) (*big.Int, error) {
+	sign, err := d.read(1, what+" sign")
+	if err != nil {
+		return nil, err
+	}
+	if sign[0] > 1 {
+		return nil, fmt.Errorf("%w: %s has bad sign %d at offset %d", ErrMalformed, what, sign[0], d.offset-1)
+	}
+	b, err := d.readBytes(what)
+	if err != nil {
+		return nil, err
+	}
+	v := new(big.Int).SetBytes(b)
+	if sign[0] == 1 {
+		v.Neg(v)
+	}
+	return v, nil
+}
+
+func (d *decoder) readConstant(i int) (object.Object, error) {
+	what := fmt.Sprintf("constant %d", i)
+
+	tag, err := d.read(1, what+" tag")
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag[0] {
+	case TagInteger:
+		v, err := d.readUint64(what)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Integer{Value: int64(v)}, nil
+	case TagFloat:
+		v, err := d.readUint64(what)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Float{Value: math.Float64frombits(v)}, nil
+	case TagBigInt:
+		v, err := d.readBigInt(what)
+		if err != nil {
+			return nil, err
+		}
+		return object.NewInteger(v), nil
+	case TagDecimal:
+		scale, err := d.readUint32(what + " scale")
+		if err != nil {
+			return nil, err
+		}
+		if scale > MaxDecimalScale {
+			return nil, fmt.Errorf("%w: %s has decimal scale %d at offset %d, at most %d", ErrMalformed, what, scale, d.offset-4, MaxDecimalScale)
+		}
+		v, err := d.readBigInt(what)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Decimal{Unscaled: v, Scale: int(scale)}, nil
+	case TagString:
+		b, err := d.readBytes(what)
+		if err != nil {
+			return nil, err
+		}
+		return &object.String{Value: string(b)}, nil
+	case TagCompiledFunction:
+		numLocals, err := d.readUint16(what + " locals")
+		if err != nil {
+			return nil, err
+		}
+		numParameters, err := d.readUint16(what + " parameters")
+		if err != nil {
+			return nil, err
+		}
+		instructions, err := d.readBytes(what + " instructions")
+		if err != nil {
+			return nil, err
+		}
+		return &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     int(numLocals),
+			NumParameters: int(numParameters),
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s has unknown tag %d at offset %d", ErrMalformed, what, tag[0], d.offset-1)
+	}
+}
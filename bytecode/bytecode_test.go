@@ -0,0 +1,226 @@
+package bytecode
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/seblkma/go-himeji/compiler"
+	"github.com/seblkma/go-himeji/lexer"
+	"github.com/seblkma/go-himeji/object"
+	"github.com/seblkma/go-himeji/opcodes"
+	"github.com/seblkma/go-himeji/parser"
+)
+
+func compile(t *testing.T, input string) *compiler.ByteCode {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.ByteCode()
+}
+
+// GOFLAGS="-count=1" go test -run TestEncodeDecode
+func TestEncodeDecode(t *testing.T) {
+	input := `
+	let greeting = "guten tag";
+	let add = fn(a, b) { let c = a + b; c };
+	if (add(1, -2) < 0) { [greeting, {"x": 42}, 2.5e-3, -12.50d] }
+	`
+	bc := compile(t, input)
+
+	data, err := Encode(bc)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	if !bytes.Equal(decoded.Instructions, bc.Instructions) {
+		t.Errorf("wrong instructions.\nwant=%q\ngot =%q", bc.Instructions, decoded.Instructions)
+	}
+
+	if len(decoded.Constants) != len(bc.Constants) {
+		t.Fatalf("wrong number of constants. got=%d, want=%d", len(decoded.Constants), len(bc.Constants))
+	}
+
+	for i, want := range bc.Constants {
+		got := decoded.Constants[i]
+		switch want := want.(type) {
+		case *object.Integer:
+			if g, ok := got.(*object.Integer); !ok || g.Value != want.Value {
+				t.Errorf("constant %d wrong. got=%+v, want=%+v", i, got, want)
+			}
+		case *object.Float:
+			if g, ok := got.(*object.Float); !ok || g.Value != want.Value {
+				t.Errorf("constant %d wrong. got=%+v, want=%+v", i, got, want)
+			}
+		case *object.Decimal:
+			if g, ok := got.(*object.Decimal); !ok || g.Scale != want.Scale || g.Unscaled.Cmp(want.Unscaled) != 0 {
+				t.Errorf("constant %d wrong. got=%+v, want=%+v", i, got, want)
+			}
+		case *object.String:
+			if g, ok := got.(*object.String); !ok || g.Value != want.Value {
+				t.Errorf("constant %d wrong. got=%+v, want=%+v", i, got, want)
+			}
+		case *object.CompiledFunction:
+			g, ok := got.(*object.CompiledFunction)
+			if !ok || g.NumLocals != want.NumLocals || g.NumParameters != want.NumParameters ||
+				!bytes.Equal(g.Instructions, want.Instructions) {
+				t.Errorf("constant %d wrong. got=%+v, want=%+v", i, got, want)
+			}
+		default:
+			t.Errorf("constant %d has unexpected type %T", i, want)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestEncodeDecodeBigInt
+func TestEncodeDecodeBigInt(t *testing.T) {
+	// Integer literals out of the int64 range are compiled to BigInt constants
+	bc := compile(t, "[123456789012345678901234567890, -0xFFFF_FFFF_FFFF_FFFF]")
+
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	constants := []*big.Int{huge, new(big.Int).SetUint64(0xFFFF_FFFF_FFFF_FFFF)}
+	if len(bc.Constants) != len(constants) {
+		t.Fatalf("wrong number of constants. got=%d, want=%d", len(bc.Constants), len(constants))
+	}
+
+	data, err := Encode(bc)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	for i, want := range constants {
+		got, ok := decoded.Constants[i].(*object.BigInt)
+		if !ok || got.Value.Cmp(want) != 0 {
+			t.Errorf("constant %d wrong. got=%+v, want=%s", i, decoded.Constants[i], want)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestEncodeIsDeterministic
+func TestEncodeIsDeterministic(t *testing.T) {
+	input := `{"b": 2, "a": 1, "c": fn(x) { x }}`
+
+	first, err := Encode(compile(t, input))
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		again, err := Encode(compile(t, input))
+		if err != nil {
+			t.Fatalf("encode error: %s", err)
+		}
+		if !bytes.Equal(first, again) {
+			t.Fatalf("encoding is not deterministic")
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestEncodeHeader
+func TestEncodeHeader(t *testing.T) {
+	data, err := Encode(compile(t, "1 + 2"))
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	expected := []byte{'H', 'M', 'J', 'B', 0, FormatVersion, 0, opcodes.Version}
+	if !bytes.Equal(data[:len(expected)], expected) {
+		t.Errorf("wrong header. got=%v, want=%v", data[:len(expected)], expected)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestDecodeErrors
+func TestDecodeErrors(t *testing.T) {
+	valid, err := Encode(compile(t, `let f = fn(a) { a + "!" }; f("hi")`))
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	badMagic := append([]byte("GOB!"), valid[4:]...)
+
+	newerFormat := append([]byte{}, valid...)
+	newerFormat[5] = FormatVersion + 1
+
+	newerOpcodes := append([]byte{}, valid...)
+	newerOpcodes[7] = opcodes.Version + 1
+
+	unknownTag := append([]byte{}, valid...)
+	unknownTag[12] = 0xff // the tag of the first constant
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"empty", []byte{}, ErrTruncated},
+		{"bad magic", badMagic, ErrBadMagic},
+		{"newer format", newerFormat, ErrUnsupportedVersion},
+		{"newer opcodes", newerOpcodes, ErrUnsupportedVersion},
+		{"unknown tag", unknownTag, ErrMalformed},
+		{"trailing bytes", append(append([]byte{}, valid...), 0), ErrMalformed},
+		{"huge decimal scale", decimalFile(0xFFFF_FFFF), ErrMalformed},
+		{"decimal scale over the limit", decimalFile(MaxDecimalScale + 1), ErrMalformed},
+	}
+
+	// Every proper prefix of a valid file is truncated
+	for i := len(Magic); i < len(valid); i++ {
+		tests = append(tests, struct {
+			name     string
+			data     []byte
+			expected error
+		}{"truncated", valid[:i], ErrTruncated})
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(tt.data)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s (%d bytes): wrong error. got=%v, want=%v", tt.name, len(tt.data), err, tt.expected)
+		}
+	}
+
+	decoded, err := Decode(decimalFile(MaxDecimalScale))
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	if d, ok := decoded.Constants[0].(*object.Decimal); !ok || d.Scale != MaxDecimalScale {
+		t.Errorf("wrong constant. got=%+v", decoded.Constants[0])
+	}
+
+	_, err = Encode(&compiler.ByteCode{Constants: []object.Object{&object.Decimal{Unscaled: big.NewInt(1), Scale: MaxDecimalScale + 1}}})
+	if err == nil {
+		t.Errorf("expected an encode error for a decimal scale over the limit")
+	}
+}
+
+// decimalFile builds a .bin file by hand with a single decimal constant 1 × 10^-scale
+func decimalFile(scale uint32) []byte {
+	var out bytes.Buffer
+	out.WriteString(Magic)
+	writeUint16(&out, FormatVersion)
+	writeUint16(&out, opcodes.Version)
+	writeUint32(&out, 1)
+	out.WriteByte(TagDecimal)
+	writeUint32(&out, scale)
+	writeBigInt(&out, big.NewInt(1))
+	writeBytes(&out, nil)
+	return out.Bytes()
+}
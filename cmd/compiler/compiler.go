@@ -1,33 +1,30 @@
 package main
 
 import (
-	"bytes"
-	"encoding/gob"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/seblkma/go-himeji/cmd/common"
+	"github.com/seblkma/go-himeji/bytecode"
 	"github.com/seblkma/go-himeji/compiler"
+	"github.com/seblkma/go-himeji/diagnostic"
 	"github.com/seblkma/go-himeji/lexer"
-	"github.com/seblkma/go-himeji/object"
 	"github.com/seblkma/go-himeji/parser"
 	// naming conflicts with go/token
 )
 
-func init() {
-	// Register the concrete types that will be stored by gob.
-	//gob.Register(object.Integer{})
-	// See
-	// https://stackoverflow.com/questions/54766528/gob-decode-cannot-decode-interface-after-register-type
-	gob.Register(&object.Integer{})
-}
+var jsonOutput = flag.Bool("json", false, "print only the diagnostics, as JSON for editors")
 
-func printParserErrors(errors []string) {
-	for _, msg := range errors {
-		fmt.Printf("\t" + msg + "\n")
+// printDiagnostics prints the diagnostics with the offending source lines, or as JSON
+func printDiagnostics(filename, source string, diagnostics []*diagnostic.Diagnostic) {
+	if *jsonOutput {
+		diagnostic.WriteJSON(os.Stdout, diagnostics)
+		return
 	}
+	diagnostic.RenderAll(os.Stdout, filename, source, diagnostics)
 }
 
 func outputFile(filePath string, newExtension string) string {
@@ -51,11 +48,13 @@ func outputFile(filePath string, newExtension string) string {
 }
 
 func main() {
-	// Get the first command line arg (zero index)
-	inputFile := common.GetCmdArg(1, os.Args)
+	flag.Parse()
+
+	// Get the first command line arg after the flags
+	inputFile := flag.Arg(0)
 	if inputFile == "" {
 		fmt.Println("Please provide source file. Example:")
-		fmt.Printf("%s codes.txt\n", os.Args[0])
+		fmt.Printf("%s [-json] codes.txt\n", os.Args[0])
 		os.Exit(1)
 	}
 
@@ -67,24 +66,38 @@ func main() {
 
 	outFile := outputFile(inputFile, ".bin")
 	line := string(src)
-	fmt.Printf("Source codes:\n%s\n", line)
+	if !*jsonOutput {
+		fmt.Printf("Source codes:\n%s\n", line)
+	}
 
 	l := lexer.New(line)
 	p := parser.New(l)
 
 	program := p.ParseProgram()
-	if len(p.Errors()) != 0 {
-		printParserErrors(p.Errors())
+	if len(p.Diagnostics()) != 0 {
+		printDiagnostics(inputFile, line, p.Diagnostics())
 		os.Exit(1)
 	}
 
 	comp := compiler.New()
 	err = comp.Compile(program)
+	var d *diagnostic.Diagnostic
+	if errors.As(err, &d) {
+		printDiagnostics(inputFile, line, []*diagnostic.Diagnostic{d})
+		os.Exit(1)
+	}
 	if err != nil {
 		fmt.Printf("Woops! Compilation failed:\n %s\n", err)
 		os.Exit(1)
 	}
 
+	// Serialize
+	serializedData, err := bytecode.Encode(comp.ByteCode())
+	if err != nil {
+		fmt.Println("Error encoding:", err)
+		os.Exit(1)
+	}
+
 	file, err := os.Create(outFile)
 	if err != nil {
 		fmt.Println(err)
@@ -92,30 +105,14 @@ func main() {
 	}
 	defer file.Close()
 
-	bc := comp.ByteCode()
-	// Serialize
-	var buffer bytes.Buffer
-	encoder := gob.NewEncoder(&buffer)
-	if err := encoder.Encode(bc); err != nil {
-		fmt.Println("Error encoding:", err)
-		return
-	}
-	serializedData := buffer.Bytes()
-
 	n, err := file.Write(serializedData)
 	if err != nil {
 		fmt.Println("file write failed:", err)
+		os.Exit(1)
+	}
+	if *jsonOutput {
+		printDiagnostics(inputFile, line, nil)
+		return
 	}
 	fmt.Printf("%d bytes written to %s\n", n, outFile)
-
-	// Deserialize
-	/*
-		var bc *compiler.ByteCode
-		decoder := gob.NewDecoder(bytes.NewReader(serializedData))
-		if err := decoder.Decode(&bc); err != nil {
-			fmt.Println("Error decoding:", err)
-			return
-		}
-		fmt.Printf("Deserialized bytecode: %+v\n", bc)
-	*/
 }
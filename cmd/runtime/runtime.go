@@ -1,26 +1,15 @@
 package main
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
 	"os"
 
+	"github.com/seblkma/go-himeji/bytecode"
 	"github.com/seblkma/go-himeji/cmd/common"
-	"github.com/seblkma/go-himeji/compiler"
-	"github.com/seblkma/go-himeji/object"
 	"github.com/seblkma/go-himeji/vm"
 	// naming conflicts with go/token
 )
 
-func init() {
-	// Register the concrete types that will be stored by gob.
-	//gob.Register(object.Integer{})
-	// See
-	// https://stackoverflow.com/questions/54766528/gob-decode-cannot-decode-interface-after-register-type
-	gob.Register(&object.Integer{})
-}
-
 func main() {
 	// Get the first command line arg (zero index)
 	inputFile := common.GetCmdArg(1, os.Args)
@@ -42,14 +31,20 @@ func main() {
 	//fmt.Printf("serialized bytecode: %+v\n", v)
 
 	// Deserialize
-	var bc *compiler.ByteCode
-	decoder := gob.NewDecoder(bytes.NewReader(serializedData))
-	if err := decoder.Decode(&bc); err != nil {
-		fmt.Println("Error decoding:", err)
-		return
+	bc, err := bytecode.Decode(serializedData)
+	if err != nil {
+		fmt.Printf("Error decoding %s: %s\n", inputFile, err)
+		os.Exit(1)
 	}
 	fmt.Printf("Deserialized bytecode: %+v\n", bc)
 
+	// The file may come from anywhere, the VM trusts its input
+	err = vm.Verify(bc)
+	if err != nil {
+		fmt.Printf("Error verifying %s: %s\n", inputFile, err)
+		os.Exit(1)
+	}
+
 	machine := vm.New(bc)
 	err = machine.Run()
 	if err != nil {
@@ -57,7 +52,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	stackTop := machine.StackTop()
-	fmt.Printf("Result: %s\n", stackTop.Inspect())
+	lastPopped := machine.LastPoppedStackElem()
+	if lastPopped != nil {
+		fmt.Printf("Result: %s\n", lastPopped.Inspect())
+	}
 
 }
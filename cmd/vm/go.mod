@@ -5,6 +5,7 @@ go 1.22.5
 replace (
 	github.com/seblkma/go-himeji/ast => ../../ast
 	github.com/seblkma/go-himeji/compiler => ../../compiler
+	github.com/seblkma/go-himeji/diagnostic => ../../diagnostic
 	github.com/seblkma/go-himeji/evaluator => ../../evaluator
 	github.com/seblkma/go-himeji/lexer => ../../lexer
 	github.com/seblkma/go-himeji/object => ../../object
@@ -20,6 +21,7 @@ require github.com/seblkma/go-himeji/replcompiler v0.0.0-00010101000000-00000000
 require (
 	github.com/seblkma/go-himeji/ast v0.0.0-00010101000000-000000000000 // indirect
 	github.com/seblkma/go-himeji/compiler v0.0.0-00010101000000-000000000000 // indirect
+	github.com/seblkma/go-himeji/diagnostic v0.0.0-00010101000000-000000000000 // indirect
 	github.com/seblkma/go-himeji/lexer v0.0.0-00010101000000-000000000000 // indirect
 	github.com/seblkma/go-himeji/object v0.0.0-00010101000000-000000000000 // indirect
 	github.com/seblkma/go-himeji/opcodes v0.0.0-00010101000000-000000000000 // indirect
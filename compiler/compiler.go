@@ -2,8 +2,10 @@ package compiler
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/seblkma/go-himeji/ast"
+	"github.com/seblkma/go-himeji/diagnostic"
 	"github.com/seblkma/go-himeji/object"
 	"github.com/seblkma/go-himeji/opcodes"
 )
@@ -14,18 +16,69 @@ type ByteCode struct {
 	Constants    []object.Object      // evaluated by Compiler
 }
 
+// EmittedInstruction remembers an emitted opcode and where it was written to
+type EmittedInstruction struct {
+	Opcode   opcodes.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of the function body being compiled,
+// the main program is compiled in the outermost scope
+type CompilationScope struct {
+	instructions        opcodes.Instructions
+	lastInstruction     EmittedInstruction // the very last instruction emitted
+	previousInstruction EmittedInstruction // the one before lastInstruction
+	loops               []*loop            // the loops being compiled, the innermost one last
+}
+
+// loop collects the jumps of the break and continue statements of a loop, they are back-patched at its end
+type loop struct {
+	breaks    []int
+	continues []int
+}
+
 type Compiler struct {
-	instructions opcodes.Instructions
-	constants    []object.Object
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
 }
 
 func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        opcodes.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	symbolTable := NewSymbolTable()
+	DefineBuiltins(symbolTable)
+
 	return &Compiler{
-		instructions: opcodes.Instructions{},
-		constants:    []object.Object{},
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// DefineBuiltins makes all the built-in functions of object.Builtins resolvable in s.
+func DefineBuiltins(s *SymbolTable) {
+	for i, def := range object.Builtins {
+		s.DefineBuiltin(i, def.Name)
 	}
 }
 
+// NewWithState creates a Compiler that keeps the symbols and constants of previous compilations, e.g. in a REPL.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	c := New()
+	c.symbolTable = s
+	c.constants = constants
+	return c
+}
+
 func (c *Compiler) Compile(node ast.Node) error {
 	// Walk the AST recursively, evaluate them to *object types then to opcodes types
 	switch n := node.(type) {
@@ -42,8 +95,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
+		// Expression statements leave nothing behind on the stack
+		c.emit(opcodes.OpPop)
 
 	case *ast.InfixExpression:
+		if n.Operator == "&&" || n.Operator == "||" {
+			return c.compileLogical(n)
+		}
+
 		err := c.Compile(n.Left)
 		if err != nil {
 			return err
@@ -54,16 +113,587 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
+		return c.emitBinaryOperator(n.Operator, diagnostic.TokenSpan(n.Token))
+
+	case *ast.PrefixExpression:
+		err := c.Compile(n.Right)
+		if err != nil {
+			return err
+		}
+
 		switch n.Operator {
-		case "+":
-			c.emit(opcodes.OpAdd)
+		case "!":
+			c.emit(opcodes.OpBang)
+		case "-":
+			c.emit(opcodes.OpMinus)
 		default:
-			return fmt.Errorf("unknown operator %s", n.Operator)
+			return diagnostic.New(diagnostic.UnsupportedOperator, diagnostic.TokenSpan(n.Token), "unknown operator %s", n.Operator)
 		}
 
 	case *ast.IntegerLiteral:
-		intObj := &object.Integer{Value: n.Value}
+		var intObj object.Object = &object.Integer{Value: n.Value}
+		if n.Big != nil {
+			intObj = &object.BigInt{Value: n.Big}
+		}
 		c.emit(opcodes.OpConstant, c.addConstant(intObj))
+
+	case *ast.FloatLiteral:
+		floatObj := &object.Float{Value: n.Value}
+		c.emit(opcodes.OpConstant, c.addConstant(floatObj))
+
+	case *ast.DecimalLiteral:
+		decimalObj := &object.Decimal{Unscaled: n.Unscaled, Scale: n.Scale}
+		c.emit(opcodes.OpConstant, c.addConstant(decimalObj))
+
+	case *ast.Boolean:
+		if n.Value {
+			c.emit(opcodes.OpTrue)
+		} else {
+			c.emit(opcodes.OpFalse)
+		}
+
+	case *ast.IfExpression:
+		err := c.Compile(n.Condition)
+		if err != nil {
+			return err
+		}
+
+		// Jump targets are not known yet, emit with a bogus offset and back-patch later
+		jumpNotTruthyPos := c.emit(opcodes.OpJumpNotTruthy, 9999)
+
+		err = c.compileBranch(n.TrueBlock)
+		if err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(opcodes.OpJump, 9999)
+
+		afterTrueBlockPos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterTrueBlockPos)
+
+		if n.FalseBlock == nil {
+			// Like the evaluator, an if without else evaluates to null when the condition is not truthy
+			c.emit(opcodes.OpNull)
+		} else {
+			err = c.compileBranch(n.FalseBlock)
+			if err != nil {
+				return err
+			}
+		}
+
+		afterFalseBlockPos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterFalseBlockPos)
+
+	case *ast.WhileStatement:
+		return c.compileLoop(n.Condition, n.Body, nil)
+
+	case *ast.ForStatement:
+		// The init statement binds in the enclosing scope, like the evaluator does
+		if n.Init != nil {
+			err := c.Compile(n.Init)
+			if err != nil {
+				return err
+			}
+		}
+		return c.compileLoop(n.Condition, n.Body, n.Post)
+
+	case *ast.ForInStatement:
+		return c.compileForIn(n)
+
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		return c.compileLoopControl(n)
+
+	case *ast.BlockStatement:
+		for _, s := range n.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		// A function refers to itself through the variable it is bound to, which is defined first.
+		// Like in the evaluator, an assignment to the variable, inside the function or not, changes what it calls.
+		if _, ok := n.Value.(*ast.FunctionLiteral); ok {
+			symbol := c.symbolTable.Define(n.Name.Value)
+			err := c.Compile(n.Value)
+			if err != nil {
+				return err
+			}
+			c.storeSymbol(symbol)
+			return nil
+		}
+
+		err := c.Compile(n.Value)
+		if err != nil {
+			return err
+		}
+		symbol := c.symbolTable.Define(n.Name.Value)
+		c.storeSymbol(symbol)
+
+	case *ast.AssignStatement:
+		symbol, ok := c.symbolTable.Resolve(n.Name.Value)
+		if !ok || symbol.Scope == BuiltinScope {
+			return c.undeclaredAssignment(n.Name)
+		}
+
+		// x += 1 is compiled as x = x + 1
+		value := n.Value
+		if op := n.Operator(); op != "" {
+			value = &ast.InfixExpression{Token: n.Token, Left: n.Name, Operator: op, Right: n.Value}
+		}
+		err := c.Compile(value)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.IndexAssignStatement:
+		err := c.Compile(n.Target.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(n.Target.Index)
+		if err != nil {
+			return err
+		}
+
+		// a[i] += 1 reads a[i] without evaluating a and i a second time
+		op := n.Operator()
+		if op != "" {
+			c.emit(opcodes.OpIndexKeep)
+		}
+
+		err = c.Compile(n.Value)
+		if err != nil {
+			return err
+		}
+		if op != "" {
+			err = c.emitBinaryOperator(op, diagnostic.TokenSpan(n.Token))
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(opcodes.OpSetIndex)
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(n.Value)
+		if !ok {
+			// The evaluator reports this at run time, we know it at compile time
+			return c.undefinedVariable(n)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.StringLiteral:
+		strObj := &object.String{Value: n.Value}
+		c.emit(opcodes.OpConstant, c.addConstant(strObj))
+
+	case *ast.InterpolatedString:
+		count := 0
+		for _, part := range n.Parts {
+			if text, ok := part.(*ast.StringLiteral); ok && text.Value == "" {
+				continue // nothing to join, e.g. before "${x}"
+			}
+			err := c.Compile(part)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		c.emit(opcodes.OpString, count)
+
+	case *ast.ArrayLiteral:
+		for _, e := range n.Elements {
+			err := c.Compile(e)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(opcodes.OpArray, len(n.Elements))
+
+	case *ast.HashLiteral:
+		// Go maps have no order, sort the keys so that the emitted instructions are deterministic
+		keys := []ast.Expression{}
+		for k := range n.Pairs {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			err := c.Compile(k)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(n.Pairs[k])
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(opcodes.OpHash, len(n.Pairs)*2)
+
+	case *ast.IndexExpression:
+		err := c.Compile(n.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(n.Index)
+		if err != nil {
+			return err
+		}
+		c.emit(opcodes.OpIndex)
+
+	case *ast.FunctionLiteral:
+		c.enterScope()
+
+		// Parameters are the first local bindings of the function
+		for _, p := range n.Parameters {
+			c.symbolTable.Define(p.Value)
+		}
+
+		err := c.Compile(n.Body)
+		if err != nil {
+			return err
+		}
+
+		// Implicit return of the last expression, e.g. fn() { 42 }
+		if c.lastInstructionIs(opcodes.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		// Empty bodies, or bodies not ending with an expression, return null
+		if !c.lastInstructionIs(opcodes.OpReturnValue) {
+			c.emit(opcodes.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		instructions := c.leaveScope()
+
+		// Pushes the captured variables, OpClosure takes them off the stack
+		for _, s := range freeSymbols {
+			c.captureSymbol(s)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(n.Parameters),
+		}
+		c.emit(opcodes.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	case *ast.ReturnStatement:
+		err := c.Compile(n.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(opcodes.OpReturnValue)
+
+	case *ast.CallExpression:
+		err := c.Compile(n.Function)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range n.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(opcodes.OpCall, len(n.Arguments))
+	}
+
+	return nil
+}
+
+func (c *Compiler) undefinedVariable(ident *ast.Identifier) error {
+	span := diagnostic.TokenSpan(ident.Token)
+	d := diagnostic.New(diagnostic.UndefinedVariable, span, "undefined variable %s", ident.Value)
+
+	if name := diagnostic.Suggest(ident.Value, c.symbolTable.Names()); name != "" {
+		d.SetFix(fmt.Sprintf("a variable with a similar name exists: %s", name), span, name)
+	}
+
+	return d
+}
+
+func (c *Compiler) undeclaredAssignment(ident *ast.Identifier) error {
+	span := diagnostic.TokenSpan(ident.Token)
+	d := diagnostic.New(diagnostic.UndeclaredAssignment, span, "assignment to undeclared variable %s", ident.Value).
+		AddNote("declare it first, e.g. let %s = ...", ident.Value)
+
+	if name := diagnostic.Suggest(ident.Value, c.symbolTable.Names()); name != "" {
+		d.SetFix(fmt.Sprintf("a variable with a similar name exists: %s", name), span, name)
+	}
+
+	return d
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(opcodes.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(opcodes.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(opcodes.OpGetFree, s.Index)
+	case BuiltinScope:
+		c.emit(opcodes.OpGetBuiltin, s.Index)
+	}
+}
+
+// emitBinaryOperator emits the instruction of a binary operator, which takes its two operands off the stack
+func (c *Compiler) emitBinaryOperator(op string, span diagnostic.Span) error {
+	switch op {
+	case "+":
+		c.emit(opcodes.OpAdd)
+	case "-":
+		c.emit(opcodes.OpSub)
+	case "*":
+		c.emit(opcodes.OpMul)
+	case "/":
+		c.emit(opcodes.OpDiv)
+	case "%":
+		c.emit(opcodes.OpMod)
+	case "**":
+		c.emit(opcodes.OpPow)
+	case "&":
+		c.emit(opcodes.OpBitAnd)
+	case "|":
+		c.emit(opcodes.OpBitOr)
+	case "^":
+		c.emit(opcodes.OpBitXor)
+	case "<<":
+		c.emit(opcodes.OpShiftLeft)
+	case ">>":
+		c.emit(opcodes.OpShiftRight)
+	case ">":
+		c.emit(opcodes.OpGreaterThan)
+	case ">=":
+		c.emit(opcodes.OpGreaterThanOrEqual)
+	case "<":
+		c.emit(opcodes.OpLessThan)
+	case "<=":
+		c.emit(opcodes.OpLessThanOrEqual)
+	case "==":
+		c.emit(opcodes.OpEqual)
+	case "!=":
+		c.emit(opcodes.OpNotEqual)
+	case "..":
+		c.emit(opcodes.OpRange, 1)
+	case "..<":
+		c.emit(opcodes.OpRange, 0)
+	default:
+		return diagnostic.New(diagnostic.UnsupportedOperator, span, "unknown operator %s", op)
+	}
+	return nil
+}
+
+// storeSymbol emits the instruction setting the variable s to the value on top of the stack
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(opcodes.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(opcodes.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(opcodes.OpSetFree, s.Index)
+	}
+}
+
+// captureSymbol pushes the variable s for OpClosure, a local or free variable as Resolve only captures those.
+// It is shared with the closure rather than copied, so that an assignment on either side is seen by the other one.
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(opcodes.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(opcodes.OpCaptureFree, s.Index)
+	}
+}
+
+// compileLogical compiles a && b and a || b so that b is only evaluated if a does not decide the result, which is a Boolean.
+//
+//	a && b:  a; OpJumpNotTruthy short; b; OpBang; OpBang; OpJump end; short: OpFalse; end:
+//	a || b:  a; OpJumpNotTruthy long; OpTrue; OpJump end; long: b; OpBang; OpBang; end:
+func (c *Compiler) compileLogical(n *ast.InfixExpression) error {
+	err := c.Compile(n.Left)
+	if err != nil {
+		return err
+	}
+
+	// Jump targets are not known yet, emit with a bogus offset and back-patch later
+	jumpNotTruthyPos := c.emit(opcodes.OpJumpNotTruthy, 9999)
+
+	compileRight := func() error {
+		err := c.Compile(n.Right)
+		if err != nil {
+			return err
+		}
+		// Turns the value into a Boolean by its truthiness, like the condition of an if
+		c.emit(opcodes.OpBang)
+		c.emit(opcodes.OpBang)
+		return nil
+	}
+
+	if n.Operator == "&&" {
+		if err := compileRight(); err != nil {
+			return err
+		}
+	} else {
+		c.emit(opcodes.OpTrue)
+	}
+
+	jumpPos := c.emit(opcodes.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if n.Operator == "&&" {
+		c.emit(opcodes.OpFalse)
+	} else if err := compileRight(); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileBranch compiles a block of an if expression so that it leaves exactly one value on the stack.
+func (c *Compiler) compileBranch(blk *ast.BlockStatement) error {
+	err := c.Compile(blk)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(opcodes.OpPop) {
+		// The value of the last expression statement is the value of the block
+		c.removeLastPop()
+	} else {
+		// Empty blocks, or blocks not ending with an expression, evaluate to null
+		c.emit(opcodes.OpNull)
+	}
+
+	return nil
+}
+
+// compileLoop compiles a loop with a backward jump, a loop leaves nothing on the stack.
+// A break jumps to the end, a continue to the post statement.
+//
+//	start: condition; OpJumpNotTruthy end; body; continue: post; OpJump start; end:
+func (c *Compiler) compileLoop(condition ast.Expression, body *ast.BlockStatement, post ast.Statement) error {
+	start := len(c.currentInstructions())
+
+	// A loop without a condition only ends with a break or a return
+	jumpNotTruthyPos := -1
+	if condition != nil {
+		err := c.Compile(condition)
+		if err != nil {
+			return err
+		}
+		jumpNotTruthyPos = c.emit(opcodes.OpJumpNotTruthy, 9999)
+	}
+
+	l, err := c.compileLoopBody(body)
+	if err != nil {
+		return err
+	}
+
+	continuePos := len(c.currentInstructions())
+	if post != nil {
+		err := c.Compile(post)
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(opcodes.OpJump, start)
+
+	endPos := len(c.currentInstructions())
+	if jumpNotTruthyPos >= 0 {
+		c.changeOperand(jumpNotTruthyPos, endPos)
+	}
+	c.patchLoop(l, continuePos, endPos)
+
+	return nil
+}
+
+// compileForIn keeps the iterator on the stack during the loop, the names are bound like let statements.
+//
+//	iterable; OpIterator; start: OpIterNext end; set value; set key; body; OpJump start; end: OpPop
+func (c *Compiler) compileForIn(n *ast.ForInStatement) error {
+	err := c.Compile(n.Iterable)
+	if err != nil {
+		return err
+	}
+	c.emit(opcodes.OpIterator)
+
+	numValues := 1
+	var key Symbol
+	if n.Key != nil {
+		numValues = 2
+		key = c.symbolTable.Define(n.Key.Value)
+	}
+	value := c.symbolTable.Define(n.Value.Value)
+
+	start := c.emit(opcodes.OpIterNext, 9999, numValues)
+	c.storeSymbol(value)
+	if n.Key != nil {
+		c.storeSymbol(key)
+	}
+
+	l, err := c.compileLoopBody(n.Body)
+	if err != nil {
+		return err
+	}
+	c.emit(opcodes.OpJump, start)
+
+	// A break jumps to the OpPop of the iterator too
+	endPos := c.emit(opcodes.OpPop)
+	c.replaceInstruction(start, opcodes.Make(opcodes.OpIterNext, endPos, numValues))
+	c.patchLoop(l, start, endPos)
+
+	return nil
+}
+
+// compileLoopBody compiles the body of a loop, collecting the jumps of its break and continue statements
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement) (*loop, error) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &loop{})
+	err := c.Compile(body)
+
+	// The body may have entered and left function scopes, c.scopes may have been reallocated
+	scope = &c.scopes[c.scopeIndex]
+	l := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	return l, err
+}
+
+// patchLoop back-patches the jumps of the break and continue statements of a loop
+func (c *Compiler) patchLoop(l *loop, continuePos, endPos int) {
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, endPos)
+	}
+	for _, pos := range l.continues {
+		c.changeOperand(pos, continuePos)
+	}
+}
+
+// compileLoopControl emits the jump of a break or continue, it is back-patched at the end of the innermost loop
+func (c *Compiler) compileLoopControl(stmt ast.Node) error {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		// The parser reports it already
+		return diagnostic.New(diagnostic.MisplacedBreak, diagnostic.TextSpan(stmt.Pos(), stmt.TokenLiteral()),
+			"%s outside a loop", stmt.TokenLiteral())
+	}
+
+	l := loops[len(loops)-1]
+	pos := c.emit(opcodes.OpJump, 9999)
+	if _, ok := stmt.(*ast.BreakStatement); ok {
+		l.breaks = append(l.breaks, pos)
+	} else {
+		l.continues = append(l.continues, pos)
 	}
 
 	return nil
@@ -74,9 +704,16 @@ func (c *Compiler) addConstant(obj object.Object) int {
 	return len(c.constants) - 1
 }
 
+func (c *Compiler) currentInstructions() opcodes.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
-	posNewInstruction := len(c.instructions)
-	c.instructions = append(c.instructions, ins...)
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
 	return posNewInstruction
 }
 
@@ -85,12 +722,87 @@ func (c *Compiler) addInstruction(ins []byte) int {
 func (c *Compiler) emit(op opcodes.Opcode, operands ...int) int {
 	ins := opcodes.Make(op, operands...)
 	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
 	return pos
 }
 
+func (c *Compiler) setLastInstruction(op opcodes.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op opcodes.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, opcodes.Make(opcodes.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = opcodes.OpReturnValue
+}
+
+// replaceInstruction overwrites the instruction at pos, the new instruction must have the same width.
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// changeOperand back-patches the operand of the instruction at opPos.
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := opcodes.Opcode(c.currentInstructions()[opPos])
+	newInstruction := opcodes.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+// enterScope starts compiling the body of a function with its own instructions and symbols.
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        opcodes.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// leaveScope returns the instructions compiled since the matching enterScope.
+func (c *Compiler) leaveScope() opcodes.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
 func (c *Compiler) ByteCode() *ByteCode {
 	return &ByteCode{
-		Instructions: c.instructions,
+		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
 	}
 }
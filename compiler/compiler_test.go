@@ -2,9 +2,11 @@ package compiler
 
 import (
 	"fmt"
+	"math/big"
 	"testing"
 
 	"github.com/seblkma/go-himeji/ast"
+	"github.com/seblkma/go-himeji/diagnostic"
 	"github.com/seblkma/go-himeji/lexer"
 	"github.com/seblkma/go-himeji/object"
 	"github.com/seblkma/go-himeji/opcodes"
@@ -59,6 +61,19 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	}
+
+	return nil
+}
+
 func testConstants(t *testing.T, expected []interface{}, actual []object.Object) error {
 	if len(actual) != len(expected) {
 		return fmt.Errorf("wrong number of constants. got=%d, want=%d", len(actual), len(expected))
@@ -71,6 +86,31 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 			if err != nil {
 				return fmt.Errorf("constant %d - testIntegerObject failed: %s", i, err)
 			}
+		case float64:
+			float, ok := actual[i].(*object.Float)
+			if !ok || float.Value != constant {
+				return fmt.Errorf("constant %d - not Float %g: %T (%+v)", i, constant, actual[i], actual[i])
+			}
+		case *object.Decimal:
+			decimal, ok := actual[i].(*object.Decimal)
+			if !ok || decimal.Inspect() != constant.Inspect() {
+				return fmt.Errorf("constant %d - not Decimal %s: %T (%+v)", i, constant.Inspect(), actual[i], actual[i])
+			}
+		case string:
+			err := testStringObject(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
+			}
+		case []opcodes.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+
+			err := testInstructions(constant, fn.Instructions)
+			if err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
 		}
 	}
 
@@ -113,6 +153,1169 @@ func TestIntegerArithmetic(t *testing.T) {
 				opcodes.Make(opcodes.OpConstant, 0),
 				opcodes.Make(opcodes.OpConstant, 1),
 				opcodes.Make(opcodes.OpAdd),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "1; 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpPop),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "1 - 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpSub),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "1 * 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpMul),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "2 / 1",
+			expectedConstants: []interface{}{2, 1},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpDiv),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpMinus),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestFloatArithmetic
+func TestFloatArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1.5 * 2",
+			expectedConstants: []interface{}{1.5, 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpMul),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "-2e3",
+			expectedConstants: []interface{}{2000.0},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpMinus),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestDecimalArithmetic
+func TestDecimalArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "12.50d + 1",
+			expectedConstants: []interface{}{&object.Decimal{Unscaled: big.NewInt(1250), Scale: 2}, 1},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpAdd),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestBooleanExpressions
+func TestBooleanExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpTrue),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpFalse),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "1 > 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpGreaterThan),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpLessThan),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "1 == 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpEqual),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "1 != 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpNotEqual),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "true != false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpTrue),
+				opcodes.Make(opcodes.OpFalse),
+				opcodes.Make(opcodes.OpNotEqual),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "!true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpTrue),
+				opcodes.Make(opcodes.OpBang),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestOperators
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected opcodes.Opcode
+	}{
+		{"1 % 2", opcodes.OpMod},
+		{"1 ** 2", opcodes.OpPow},
+		{"1 & 2", opcodes.OpBitAnd},
+		{"1 | 2", opcodes.OpBitOr},
+		{"1 ^ 2", opcodes.OpBitXor},
+		{"1 << 2", opcodes.OpShiftLeft},
+		{"1 >> 2", opcodes.OpShiftRight},
+		{"1 >= 2", opcodes.OpGreaterThanOrEqual},
+		{"1 <= 2", opcodes.OpLessThanOrEqual},
+	}
+
+	var cases []compilerTestCase
+	for _, tt := range tests {
+		cases = append(cases, compilerTestCase{
+			input:             tt.input,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(tt.expected),
+				opcodes.Make(opcodes.OpPop),
+			},
+		})
+	}
+
+	runCompilerTests(t, cases)
+}
+
+// GOFLAGS="-count=1" go test -run TestLogicalOperators
+func TestLogicalOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcodes.Instructions{
+				// 0000
+				opcodes.Make(opcodes.OpTrue),
+				// 0001, to the false result
+				opcodes.Make(opcodes.OpJumpNotTruthy, 10),
+				// 0004
+				opcodes.Make(opcodes.OpFalse),
+				// 0005
+				opcodes.Make(opcodes.OpBang),
+				// 0006
+				opcodes.Make(opcodes.OpBang),
+				// 0007
+				opcodes.Make(opcodes.OpJump, 11),
+				// 0010
+				opcodes.Make(opcodes.OpFalse),
+				// 0011
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "true || false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcodes.Instructions{
+				// 0000
+				opcodes.Make(opcodes.OpTrue),
+				// 0001, to the rhs
+				opcodes.Make(opcodes.OpJumpNotTruthy, 8),
+				// 0004
+				opcodes.Make(opcodes.OpTrue),
+				// 0005
+				opcodes.Make(opcodes.OpJump, 11),
+				// 0008
+				opcodes.Make(opcodes.OpFalse),
+				// 0009
+				opcodes.Make(opcodes.OpBang),
+				// 0010
+				opcodes.Make(opcodes.OpBang),
+				// 0011
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestConditionals
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []opcodes.Instructions{
+				// 0000
+				opcodes.Make(opcodes.OpTrue),
+				// 0001
+				opcodes.Make(opcodes.OpJumpNotTruthy, 10),
+				// 0004
+				opcodes.Make(opcodes.OpConstant, 0),
+				// 0007
+				opcodes.Make(opcodes.OpJump, 11),
+				// 0010
+				opcodes.Make(opcodes.OpNull),
+				// 0011
+				opcodes.Make(opcodes.OpPop),
+				// 0012
+				opcodes.Make(opcodes.OpConstant, 1),
+				// 0015
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { 10 } else { 20 }; 3333;",
+			expectedConstants: []interface{}{10, 20, 3333},
+			expectedInstructions: []opcodes.Instructions{
+				// 0000
+				opcodes.Make(opcodes.OpTrue),
+				// 0001
+				opcodes.Make(opcodes.OpJumpNotTruthy, 10),
+				// 0004
+				opcodes.Make(opcodes.OpConstant, 0),
+				// 0007
+				opcodes.Make(opcodes.OpJump, 13),
+				// 0010
+				opcodes.Make(opcodes.OpConstant, 1),
+				// 0013
+				opcodes.Make(opcodes.OpPop),
+				// 0014
+				opcodes.Make(opcodes.OpConstant, 2),
+				// 0017
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcodes.Instructions{
+				// 0000
+				opcodes.Make(opcodes.OpTrue),
+				// 0001
+				opcodes.Make(opcodes.OpJumpNotTruthy, 8),
+				// 0004
+				opcodes.Make(opcodes.OpNull),
+				// 0005
+				opcodes.Make(opcodes.OpJump, 9),
+				// 0008
+				opcodes.Make(opcodes.OpNull),
+				// 0009
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestGlobalLetStatements
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let one = 1;
+			let two = 2;
+			`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpSetGlobal, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpSetGlobal, 1),
+			},
+		},
+		{
+			input: `
+			let one = 1;
+			one;
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpSetGlobal, 0),
+				opcodes.Make(opcodes.OpGetGlobal, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input: `
+			let one = 1;
+			let two = one;
+			two;
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpSetGlobal, 0),
+				opcodes.Make(opcodes.OpGetGlobal, 0),
+				opcodes.Make(opcodes.OpSetGlobal, 1),
+				opcodes.Make(opcodes.OpGetGlobal, 1),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestUndefinedVariable
+func TestUndefinedVariable(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"foobar", "1:1: undefined variable foobar"},
+		{"let a = b;", "1:9: undefined variable b"},
+		{"let a = 1; a + c", "1:16: undefined variable c"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compiler error for %q", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestUndefinedVariableDiagnostic
+func TestUndefinedVariableDiagnostic(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedFix string
+	}{
+		{"let counter = 1; countr", "counter"},
+		{"fn(value) { valeu }", "value"},
+		{"lne([])", "len"},
+		{"let a = 1; zzz", ""},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+
+		err := compiler.Compile(program)
+		d, ok := err.(*diagnostic.Diagnostic)
+		if !ok {
+			t.Fatalf("expected a diagnostic for %q. got=%T (%v)", tt.input, err, err)
+		}
+		if d.Code != diagnostic.UndefinedVariable {
+			t.Errorf("wrong code. want=%s, got=%s", diagnostic.UndefinedVariable, d.Code)
+		}
+
+		if tt.expectedFix == "" {
+			if d.Fix != nil {
+				t.Errorf("expected no fix for %q. got=%+v", tt.input, d.Fix)
+			}
+			continue
+		}
+		if d.Fix == nil || d.Fix.Replacement != tt.expectedFix {
+			t.Errorf("wrong fix for %q. want=%q, got=%+v", tt.input, tt.expectedFix, d.Fix)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestAssignments
+func TestAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1; x = 2; x += 3;",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpSetGlobal, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpSetGlobal, 0),
+				opcodes.Make(opcodes.OpGetGlobal, 0),
+				opcodes.Make(opcodes.OpConstant, 2),
+				opcodes.Make(opcodes.OpAdd),
+				opcodes.Make(opcodes.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: "fn(a) { a <<= 1; a }",
+			expectedConstants: []interface{}{
+				1,
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpGetLocal, 0),
+					opcodes.Make(opcodes.OpConstant, 0),
+					opcodes.Make(opcodes.OpShiftLeft),
+					opcodes.Make(opcodes.OpSetLocal, 0),
+					opcodes.Make(opcodes.OpGetLocal, 0),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpClosure, 1, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input: "fn() { let count = 0; fn() { count -= 1 } }",
+			expectedConstants: []interface{}{
+				0,
+				1,
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpGetFree, 0),
+					opcodes.Make(opcodes.OpConstant, 1),
+					opcodes.Make(opcodes.OpSub),
+					opcodes.Make(opcodes.OpSetFree, 0),
+					opcodes.Make(opcodes.OpReturn),
+				},
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpConstant, 0),
+					opcodes.Make(opcodes.OpSetLocal, 0),
+					opcodes.Make(opcodes.OpCaptureLocal, 0),
+					opcodes.Make(opcodes.OpClosure, 2, 1),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpClosure, 3, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestAssignmentErrors
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedCode string
+		expected     string
+	}{
+		{"x = 1", diagnostic.UndeclaredAssignment, "1:1: assignment to undeclared variable x"},
+		{"let total = 0; fn() { totl += 1 }", diagnostic.UndeclaredAssignment, "1:23: assignment to undeclared variable totl"},
+		{"len = 1", diagnostic.UndeclaredAssignment, "1:1: assignment to undeclared variable len"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+
+		err := compiler.Compile(program)
+		d, ok := err.(*diagnostic.Diagnostic)
+		if !ok {
+			t.Fatalf("expected a diagnostic for %q. got=%T (%v)", tt.input, err, err)
+		}
+		if d.Code != tt.expectedCode || d.Error() != tt.expected {
+			t.Errorf("wrong compiler error. want=%s %q, got=%s %q", tt.expectedCode, tt.expected, d.Code, d.Error())
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestIndexAssignments
+func TestIndexAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let a = [1]; a[0] = 2;",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpArray, 1),
+				opcodes.Make(opcodes.OpSetGlobal, 0),
+				opcodes.Make(opcodes.OpGetGlobal, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpConstant, 2),
+				opcodes.Make(opcodes.OpSetIndex),
+			},
+		},
+		{
+			input:             "let h = {}; h[1][2] -= 3;",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpHash, 0),
+				opcodes.Make(opcodes.OpSetGlobal, 0),
+				opcodes.Make(opcodes.OpGetGlobal, 0),
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpIndex),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpIndexKeep),
+				opcodes.Make(opcodes.OpConstant, 2),
+				opcodes.Make(opcodes.OpSub),
+				opcodes.Make(opcodes.OpSetIndex),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestLoops
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "while (true) { break; continue; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpTrue),              // 0000
+				opcodes.Make(opcodes.OpJumpNotTruthy, 13), // 0001
+				opcodes.Make(opcodes.OpJump, 13),          // 0004 break
+				opcodes.Make(opcodes.OpJump, 10),          // 0007 continue
+				opcodes.Make(opcodes.OpJump, 0),           // 0010
+			},
+		},
+		{
+			input:             "for (let i = 0; ; i += 1) { continue }",
+			expectedConstants: []interface{}{0, 1},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),  // 0000
+				opcodes.Make(opcodes.OpSetGlobal, 0), // 0003
+				opcodes.Make(opcodes.OpJump, 9),      // 0006 continue
+				opcodes.Make(opcodes.OpGetGlobal, 0), // 0009
+				opcodes.Make(opcodes.OpConstant, 1),  // 0012
+				opcodes.Make(opcodes.OpAdd),          // 0015
+				opcodes.Make(opcodes.OpSetGlobal, 0), // 0016
+				opcodes.Make(opcodes.OpJump, 6),      // 0019
+			},
+		},
+		{
+			// The break of the inner loop jumps to the end of the inner loop
+			input:             "while (true) { while (false) { break } }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpTrue),              // 0000
+				opcodes.Make(opcodes.OpJumpNotTruthy, 17), // 0001
+				opcodes.Make(opcodes.OpFalse),             // 0004
+				opcodes.Make(opcodes.OpJumpNotTruthy, 14), // 0005
+				opcodes.Make(opcodes.OpJump, 14),          // 0008 break
+				opcodes.Make(opcodes.OpJump, 4),           // 0011
+				opcodes.Make(opcodes.OpJump, 0),           // 0014
+			},
+		},
+		{
+			// The iterator stays on the stack during the loop, a break jumps to the OpPop removing it
+			input:             "for (x in [1]) { break }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),     // 0000
+				opcodes.Make(opcodes.OpArray, 1),        // 0003
+				opcodes.Make(opcodes.OpIterator),        // 0006
+				opcodes.Make(opcodes.OpIterNext, 20, 1), // 0007
+				opcodes.Make(opcodes.OpSetGlobal, 0),    // 0011
+				opcodes.Make(opcodes.OpJump, 20),        // 0014 break
+				opcodes.Make(opcodes.OpJump, 7),         // 0017
+				opcodes.Make(opcodes.OpPop),             // 0020
+			},
+		},
+		{
+			input:             "for (k, v in 1..<2) { continue }",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),     // 0000
+				opcodes.Make(opcodes.OpConstant, 1),     // 0003
+				opcodes.Make(opcodes.OpRange, 0),        // 0006
+				opcodes.Make(opcodes.OpIterator),        // 0008
+				opcodes.Make(opcodes.OpIterNext, 25, 2), // 0009
+				opcodes.Make(opcodes.OpSetGlobal, 1),    // 0013 v
+				opcodes.Make(opcodes.OpSetGlobal, 0),    // 0016 k
+				opcodes.Make(opcodes.OpJump, 9),         // 0019 continue
+				opcodes.Make(opcodes.OpJump, 9),         // 0022
+				opcodes.Make(opcodes.OpPop),             // 0025
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestStringExpressions
+func TestStringExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"himeji"`,
+			expectedConstants: []interface{}{"himeji"},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             `"hime" + "ji"`,
+			expectedConstants: []interface{}{"hime", "ji"},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpAdd),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             `"a ${1} b ${2}"`,
+			expectedConstants: []interface{}{"a ", 1, " b ", 2},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpConstant, 2),
+				opcodes.Make(opcodes.OpConstant, 3),
+				opcodes.Make(opcodes.OpString, 4),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             `"${true}"`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpTrue),
+				opcodes.Make(opcodes.OpString, 1),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestArrayLiterals
+func TestArrayLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[]",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpArray, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2, 3]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpConstant, 2),
+				opcodes.Make(opcodes.OpArray, 3),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "[1 + 2, 3 - 4]",
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpAdd),
+				opcodes.Make(opcodes.OpConstant, 2),
+				opcodes.Make(opcodes.OpConstant, 3),
+				opcodes.Make(opcodes.OpSub),
+				opcodes.Make(opcodes.OpArray, 2),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestHashLiterals
+func TestHashLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpHash, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			// keys are emitted in sorted order
+			input:             "{3: 4, 1: 2}",
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpConstant, 2),
+				opcodes.Make(opcodes.OpConstant, 3),
+				opcodes.Make(opcodes.OpHash, 4),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestIndexExpressions
+func TestIndexExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, 2][1]",
+			expectedConstants: []interface{}{1, 2, 1},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpArray, 2),
+				opcodes.Make(opcodes.OpConstant, 2),
+				opcodes.Make(opcodes.OpIndex),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2}[1]",
+			expectedConstants: []interface{}{1, 2, 1},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpHash, 2),
+				opcodes.Make(opcodes.OpConstant, 2),
+				opcodes.Make(opcodes.OpIndex),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestFunctions
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { return 5 + 10 }`,
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpConstant, 0),
+					opcodes.Make(opcodes.OpConstant, 1),
+					opcodes.Make(opcodes.OpAdd),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpClosure, 2, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			// implicit return of the last expression
+			input: `fn() { 5 + 10 }`,
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpConstant, 0),
+					opcodes.Make(opcodes.OpConstant, 1),
+					opcodes.Make(opcodes.OpAdd),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpClosure, 2, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input: `fn() { }`,
+			expectedConstants: []interface{}{
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpReturn),
+				},
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpClosure, 0, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestCompilerScopes
+func TestCompilerScopes(t *testing.T) {
+	compiler := New()
+	if compiler.scopeIndex != 0 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 0)
+	}
+	globalSymbolTable := compiler.symbolTable
+
+	compiler.emit(opcodes.OpMul)
+
+	compiler.enterScope()
+	if compiler.scopeIndex != 1 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 1)
+	}
+
+	compiler.emit(opcodes.OpSub)
+
+	if len(compiler.scopes[compiler.scopeIndex].instructions) != 1 {
+		t.Errorf("instructions length wrong. got=%d", len(compiler.scopes[compiler.scopeIndex].instructions))
+	}
+
+	last := compiler.scopes[compiler.scopeIndex].lastInstruction
+	if last.Opcode != opcodes.OpSub {
+		t.Errorf("lastInstruction.Opcode wrong. got=%d, want=%d", last.Opcode, opcodes.OpSub)
+	}
+
+	if compiler.symbolTable.Outer != globalSymbolTable {
+		t.Errorf("compiler did not enclose symbolTable")
+	}
+
+	compiler.leaveScope()
+	if compiler.scopeIndex != 0 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 0)
+	}
+
+	if compiler.symbolTable != globalSymbolTable {
+		t.Errorf("compiler did not restore global symbol table")
+	}
+	if compiler.symbolTable.Outer != nil {
+		t.Errorf("compiler modified global symbol table incorrectly")
+	}
+
+	compiler.emit(opcodes.OpAdd)
+
+	if len(compiler.scopes[compiler.scopeIndex].instructions) != 2 {
+		t.Errorf("instructions length wrong. got=%d", len(compiler.scopes[compiler.scopeIndex].instructions))
+	}
+
+	last = compiler.scopes[compiler.scopeIndex].lastInstruction
+	if last.Opcode != opcodes.OpAdd {
+		t.Errorf("lastInstruction.Opcode wrong. got=%d, want=%d", last.Opcode, opcodes.OpAdd)
+	}
+
+	previous := compiler.scopes[compiler.scopeIndex].previousInstruction
+	if previous.Opcode != opcodes.OpMul {
+		t.Errorf("previousInstruction.Opcode wrong. got=%d, want=%d", previous.Opcode, opcodes.OpMul)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestFunctionCalls
+func TestFunctionCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { 24 }();`,
+			expectedConstants: []interface{}{
+				24,
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpConstant, 0),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpClosure, 1, 0),
+				opcodes.Make(opcodes.OpCall, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input: `
+			let manyArg = fn(a, b) { a; b };
+			manyArg(24, 25);
+			`,
+			expectedConstants: []interface{}{
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpGetLocal, 0),
+					opcodes.Make(opcodes.OpPop),
+					opcodes.Make(opcodes.OpGetLocal, 1),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+				24,
+				25,
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpClosure, 0, 0),
+				opcodes.Make(opcodes.OpSetGlobal, 0),
+				opcodes.Make(opcodes.OpGetGlobal, 0),
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpConstant, 2),
+				opcodes.Make(opcodes.OpCall, 2),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestLetStatementScopes
+func TestLetStatementScopes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let num = 55;
+			fn() { num }
+			`,
+			expectedConstants: []interface{}{
+				55,
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpGetGlobal, 0),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpSetGlobal, 0),
+				opcodes.Make(opcodes.OpClosure, 1, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input: `
+			fn() {
+				let a = 55;
+				let b = 77;
+				a + b
+			}
+			`,
+			expectedConstants: []interface{}{
+				55,
+				77,
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpConstant, 0),
+					opcodes.Make(opcodes.OpSetLocal, 0),
+					opcodes.Make(opcodes.OpConstant, 1),
+					opcodes.Make(opcodes.OpSetLocal, 1),
+					opcodes.Make(opcodes.OpGetLocal, 0),
+					opcodes.Make(opcodes.OpGetLocal, 1),
+					opcodes.Make(opcodes.OpAdd),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpClosure, 2, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestClosures
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			fn(a) {
+				fn(b) {
+					a + b
+				}
+			}
+			`,
+			expectedConstants: []interface{}{
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpGetFree, 0),
+					opcodes.Make(opcodes.OpGetLocal, 0),
+					opcodes.Make(opcodes.OpAdd),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpCaptureLocal, 0),
+					opcodes.Make(opcodes.OpClosure, 0, 1),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpClosure, 1, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input: `
+			fn(a) {
+				fn(b) {
+					fn(c) {
+						a + b + c
+					}
+				}
+			};
+			`,
+			expectedConstants: []interface{}{
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpGetFree, 0),
+					opcodes.Make(opcodes.OpGetFree, 1),
+					opcodes.Make(opcodes.OpAdd),
+					opcodes.Make(opcodes.OpGetLocal, 0),
+					opcodes.Make(opcodes.OpAdd),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpCaptureFree, 0),
+					opcodes.Make(opcodes.OpCaptureLocal, 0),
+					opcodes.Make(opcodes.OpClosure, 0, 2),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpCaptureLocal, 0),
+					opcodes.Make(opcodes.OpClosure, 1, 1),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpClosure, 2, 0),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestRecursiveFunctions
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let countDown = fn(x) { countDown(x - 1); };
+			countDown(1);
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpGetGlobal, 0), // the function refers to itself through its variable
+					opcodes.Make(opcodes.OpGetLocal, 0),
+					opcodes.Make(opcodes.OpConstant, 0),
+					opcodes.Make(opcodes.OpSub),
+					opcodes.Make(opcodes.OpCall, 1),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpClosure, 1, 0),
+				opcodes.Make(opcodes.OpSetGlobal, 0),
+				opcodes.Make(opcodes.OpGetGlobal, 0),
+				opcodes.Make(opcodes.OpConstant, 2),
+				opcodes.Make(opcodes.OpCall, 1),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestBuiltins
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			len([]);
+			push([], 1);
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpGetBuiltin, 0),
+				opcodes.Make(opcodes.OpArray, 0),
+				opcodes.Make(opcodes.OpCall, 1),
+				opcodes.Make(opcodes.OpPop),
+				opcodes.Make(opcodes.OpGetBuiltin, 5),
+				opcodes.Make(opcodes.OpArray, 0),
+				opcodes.Make(opcodes.OpConstant, 0),
+				opcodes.Make(opcodes.OpCall, 2),
+				opcodes.Make(opcodes.OpPop),
+			},
+		},
+		{
+			input: `fn() { len([]) }`,
+			expectedConstants: []interface{}{
+				[]opcodes.Instructions{
+					opcodes.Make(opcodes.OpGetBuiltin, 0),
+					opcodes.Make(opcodes.OpArray, 0),
+					opcodes.Make(opcodes.OpCall, 1),
+					opcodes.Make(opcodes.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcodes.Instructions{
+				opcodes.Make(opcodes.OpClosure, 0, 0),
+				opcodes.Make(opcodes.OpPop),
 			},
 		},
 	}
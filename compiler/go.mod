@@ -4,6 +4,7 @@ go 1.22.5
 
 replace (
 	github.com/seblkma/go-himeji/ast => ../ast
+	github.com/seblkma/go-himeji/diagnostic => ../diagnostic
 	github.com/seblkma/go-himeji/lexer => ../lexer
 	github.com/seblkma/go-himeji/object => ../object
 	github.com/seblkma/go-himeji/opcodes => ../opcodes
@@ -13,6 +14,7 @@ replace (
 
 require (
 	github.com/seblkma/go-himeji/ast v0.0.0-00010101000000-000000000000
+	github.com/seblkma/go-himeji/diagnostic v0.0.0-00010101000000-000000000000
 	github.com/seblkma/go-himeji/lexer v0.0.0-00010101000000-000000000000
 	github.com/seblkma/go-himeji/object v0.0.0-00010101000000-000000000000
 	github.com/seblkma/go-himeji/opcodes v0.0.0-00010101000000-000000000000
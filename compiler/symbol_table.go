@@ -0,0 +1,110 @@
+package compiler
+
+import "sort"
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	FreeScope    SymbolScope = "FREE"
+	BuiltinScope SymbolScope = "BUILTIN"
+)
+
+// Symbol holds what the compiler needs to know about an identifier
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int // the operand of the instruction referencing this symbol
+}
+
+// SymbolTable associates identifiers to symbols
+type SymbolTable struct {
+	Outer *SymbolTable // nil for the global symbol table
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// The symbols of the outer tables captured by the function, in the order they were resolved
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	free := []Symbol{}
+	return &SymbolTable{store: s, FreeSymbols: free}
+}
+
+// NewEnclosedSymbolTable creates an inner SymbolTable with a reference to its outer SymbolTable
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define binds name to a new symbol. Symbols of the global symbol table are global, all others are local.
+// Redefining a name of the same table reuses its symbol, like let in the evaluator it updates the variable,
+// e.g. a closure reading it sees the new value. A name captured from an outer table is shadowed by a new one.
+func (s *SymbolTable) Define(name string) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	if existing, found := s.store[name]; found && existing.Scope == symbol.Scope {
+		return existing
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// DefineBuiltin binds name to the built-in function at index of object.Builtins.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// defineFree captures a local symbol of an outer SymbolTable as a free symbol of this one.
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Resolve looks up name in this SymbolTable and then in its outer SymbolTables.
+// Locals of enclosing functions are turned into free symbols on the way.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, found := s.store[name]
+	if !found && s.Outer != nil {
+		symbol, found = s.Outer.Resolve(name)
+		if !found {
+			return symbol, found
+		}
+
+		if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+			return symbol, found
+		}
+
+		return s.defineFree(symbol), true
+	}
+	return symbol, found
+}
+
+// Names returns the names resolvable from this table, e.g. to suggest one for a misspelled name
+func (s *SymbolTable) Names() []string {
+	names := []string{}
+	for table := s; table != nil; table = table.Outer {
+		for name := range table.store {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,219 @@
+// Package diagnostic describes the problems found in himeji source code by the lexer, parser,
+// compiler and evaluator, and renders them for humans (Render) and editors (WriteJSON).
+package diagnostic
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/seblkma/go-himeji/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+var severityNames = map[Severity]string{
+	Error:   "error",
+	Warning: "warning",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// MarshalText writes the severity by name in JSON
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	for severity, name := range severityNames {
+		if name == string(text) {
+			*s = severity
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// Codes of the diagnostics, the letter tells who reports it:
+// L lexer, P parser, C compiler, R evaluator at runtime.
+// A code keeps its meaning once published, editors may match on it.
+const (
+	IllegalCharacter    = "L001"
+	UnterminatedComment = "L002"
+	InvalidEncoding     = "L003"
+	UnterminatedString  = "L004"
+	InvalidEscape       = "L005"
+
+	UnexpectedToken    = "P001"
+	ExpectedExpression = "P002"
+	InvalidInteger     = "P003"
+	InvalidFloat       = "P004"
+	InvalidDecimal     = "P005"
+	InvalidAssignment  = "P006"
+	MisplacedBreak     = "P007" // also a misplaced continue
+
+	UndefinedVariable    = "C001"
+	UnsupportedOperator  = "C002"
+	UndeclaredAssignment = "C003"
+
+	TypeMismatch       = "R001"
+	UnknownOperator    = "R002"
+	IdentifierNotFound = "R003"
+	NotAFunction       = "R004"
+	UnusableAsHashKey  = "R005"
+	IndexNotSupported  = "R006"
+	WrongArgumentCount = "R007"
+	InvalidArgument    = "R008"
+	DivisionByZero     = "R009"
+	InvalidOperand     = "R010"
+	AssignToUndeclared = "R011"
+	IndexOutOfRange    = "R012"
+	NotIterable        = "R013"
+)
+
+// Span is the source text from Start up to, but excluding, End
+type Span struct {
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+}
+
+// TokenSpan returns the span of the source text of tok
+func TokenSpan(tok token.Token) Span {
+	text := tok.Literal
+	if tok.Raw != "" {
+		text = tok.Raw
+	} else if tok.Type == token.STRING {
+		text = `"` + text + `"` // the literal does not include the quotes
+	}
+	return TextSpan(tok.Pos, text)
+}
+
+// TextSpan returns the span of the source text starting at pos
+func TextSpan(pos token.Position, text string) Span {
+	return Span{Start: pos, End: advance(pos, text)}
+}
+
+// At returns the span of n bytes starting at pos, on a single line, n ASCII chars
+func At(pos token.Position, n int) Span {
+	end := pos
+	end.Offset += n
+	end.Column += n
+	return Span{Start: pos, End: end}
+}
+
+// advance moves pos past text, columns count chars, not bytes
+func advance(pos token.Position, text string) token.Position {
+	for _, ch := range text {
+		if ch == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	pos.Offset += len(text)
+	return pos
+}
+
+// Fix is a suggested edit, replacing the source text of Span by Replacement.
+// An empty Span inserts Replacement at Span.Start.
+type Fix struct {
+	Message     string `json:"message"`
+	Span        Span   `json:"span"`
+	Replacement string `json:"replacement"`
+}
+
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Span     Span     `json:"span"`
+	Message  string   `json:"message"`
+	Notes    []string `json:"notes,omitempty"`
+	Fix      *Fix     `json:"fix,omitempty"`
+}
+
+// New creates an error diagnostic
+func New(code string, span Span, format string, a ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Span:     span,
+		Message:  fmt.Sprintf(format, a...),
+	}
+}
+
+// AddNote adds a note explaining the diagnostic, returns d for chaining
+func (d *Diagnostic) AddNote(format string, a ...interface{}) *Diagnostic {
+	d.Notes = append(d.Notes, fmt.Sprintf(format, a...))
+	return d
+}
+
+// SetFix sets the suggested fix, returns d for chaining
+func (d *Diagnostic) SetFix(message string, span Span, replacement string) *Diagnostic {
+	d.Fix = &Fix{Message: message, Span: span, Replacement: replacement}
+	return d
+}
+
+// Implements error, the message is prefixed with the line:column of the span
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s", d.Span.Start, d.Message)
+}
+
+// Sort orders diagnostics by where they start in the source, keeping the order of those starting together
+func Sort(diagnostics []*Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Span.Start.Offset < diagnostics[j].Span.Start.Offset
+	})
+}
+
+// Suggest returns the candidate closest to name, e.g. to fix a typo, or "" if none is close enough
+func Suggest(name string, candidates []string) string {
+	best := ""
+	bestDistance := len(name)/3 + 1 // allows one typo in every 3 chars
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+		d := editDistance(name, c)
+		if d < bestDistance || d == bestDistance && best != "" && c < best {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+// editDistance is the number of inserts, deletes, substitutions and swaps of adjacent bytes turning a into b
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
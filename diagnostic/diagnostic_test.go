@@ -0,0 +1,188 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/seblkma/go-himeji/token"
+)
+
+func pos(offset, line, column int) token.Position {
+	return token.Position{Offset: offset, Line: line, Column: column}
+}
+
+// GOFLAGS="-count=1" go test -run TestRender
+func TestRender(t *testing.T) {
+	source := "let x = 1;\n\tlet y 2;\n"
+
+	d := New(UnexpectedToken, At(pos(18, 2, 8), 1), "expected next token is =, but got INT instead")
+	d.AddNote("a let statement binds a name to a value")
+	d.SetFix(`insert "="`, At(pos(18, 2, 8), 0), "=")
+
+	expected := "error[P001]: expected next token is =, but got INT instead\n" +
+		" --> codes.txt:2:8\n" +
+		"  |\n" +
+		"2 | \tlet y 2;\n" +
+		"  | \t      ^\n" +
+		"  = note: a let statement binds a name to a value\n" +
+		"  = help: insert \"=\"\n"
+
+	var out bytes.Buffer
+	Render(&out, "codes.txt", source, d)
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestRenderUnderline
+func TestRenderUnderline(t *testing.T) {
+	source := "let total = count + 1;"
+
+	tests := []struct {
+		span     Span
+		expected string
+	}{
+		{TokenSpan(token.Token{Type: token.IDENT, Literal: "count", Pos: pos(12, 1, 13)}), "            ^^^^^"},
+		{At(pos(0, 1, 1), 0), "^"},
+		{Span{Start: pos(4, 1, 5), End: pos(30, 2, 3)}, "    ^^^^^^^^^^^^^^^^^^"},
+	}
+
+	for _, tt := range tests {
+		line, _ := sourceLine(source, 1)
+		got := underline(line, tt.span.Start.Column, tt.span)
+		if got != tt.expected {
+			t.Errorf("wrong underline.\nwant=%q\ngot =%q", tt.expected, got)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestRenderWideChars
+func TestRenderWideChars(t *testing.T) {
+	source := `let 名前 = "城" + größe;`
+
+	d := New(UndefinedVariable, TextSpan(pos(28, 1, 19), "größe"), "undefined variable größe")
+
+	expected := "error[C001]: undefined variable größe\n" +
+		" --> codes.txt:1:19\n" +
+		"  |\n" +
+		"1 | let 名前 = \"城\" + größe;\n" +
+		"  |                      ^^^^^\n"
+
+	var out bytes.Buffer
+	Render(&out, "codes.txt", source, d)
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestRenderWithoutPosition
+func TestRenderWithoutPosition(t *testing.T) {
+	d := New(NotAFunction, Span{}, "not a function: INTEGER")
+
+	var out bytes.Buffer
+	Render(&out, "codes.txt", "1(2)", d)
+
+	expected := "error[R004]: not a function: INTEGER\n"
+	if out.String() != expected {
+		t.Errorf("wrong rendering. want=%q, got=%q", expected, out.String())
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestWriteJSON
+func TestWriteJSON(t *testing.T) {
+	d := New(UndefinedVariable, At(pos(4, 1, 5), 3), "undefined variable foo")
+	d.SetFix("a variable with a similar name exists: for", At(pos(4, 1, 5), 3), "for")
+
+	var out bytes.Buffer
+	err := WriteJSON(&out, []*Diagnostic{d})
+	if err != nil {
+		t.Fatalf("WriteJSON failed: %s", err)
+	}
+
+	var decoded []map[string]interface{}
+	err = json.Unmarshal(out.Bytes(), &decoded)
+	if err != nil {
+		t.Fatalf("invalid JSON: %s\n%s", err, out.String())
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("wrong number of diagnostics. got=%d", len(decoded))
+	}
+
+	got := decoded[0]
+	if got["severity"] != "error" || got["code"] != "C001" || got["message"] != "undefined variable foo" {
+		t.Errorf("wrong fields. got=%v", got)
+	}
+	start := got["span"].(map[string]interface{})["start"].(map[string]interface{})
+	if start["line"] != 1.0 || start["column"] != 5.0 || start["offset"] != 4.0 {
+		t.Errorf("wrong span start. got=%v", start)
+	}
+	if _, ok := got["notes"]; ok {
+		t.Errorf("empty notes must be omitted. got=%v", got["notes"])
+	}
+	if got["fix"].(map[string]interface{})["replacement"] != "for" {
+		t.Errorf("wrong fix. got=%v", got["fix"])
+	}
+
+	var roundTrip []*Diagnostic
+	err = json.Unmarshal(out.Bytes(), &roundTrip)
+	if err != nil {
+		t.Fatalf("cannot decode diagnostics: %s", err)
+	}
+	if roundTrip[0].Severity != Error || roundTrip[0].Span != d.Span {
+		t.Errorf("diagnostic changed in JSON. want=%+v, got=%+v", d, roundTrip[0])
+	}
+
+	out.Reset()
+	WriteJSON(&out, nil)
+	if out.String() != "[]\n" {
+		t.Errorf("no diagnostics must be an empty array. got=%q", out.String())
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestSuggest
+func TestSuggest(t *testing.T) {
+	candidates := []string{"len", "first", "last", "counter", "count"}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"lne", "len"},
+		{"frist", "first"},
+		{"countr", "count"},
+		{"counterr", "counter"},
+		{"x", ""},
+		{"push", ""},
+		{"len", ""},
+	}
+
+	for _, tt := range tests {
+		got := Suggest(tt.name, candidates)
+		if got != tt.expected {
+			t.Errorf("wrong suggestion for %q. want=%q, got=%q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestTokenSpan
+func TestTokenSpan(t *testing.T) {
+	tests := []struct {
+		tok      token.Token
+		expected Span
+	}{
+		{token.Token{Type: token.IDENT, Literal: "abc", Pos: pos(2, 1, 3)}, Span{pos(2, 1, 3), pos(5, 1, 6)}},
+		{token.Token{Type: token.STRING, Literal: "ab", Pos: pos(0, 1, 1)}, Span{pos(0, 1, 1), pos(4, 1, 5)}},
+		{token.Token{Type: token.STRING, Literal: "a\nb", Pos: pos(0, 1, 1)}, Span{pos(0, 1, 1), pos(5, 2, 3)}},
+		{token.Token{Type: token.EOF, Literal: "", Pos: pos(7, 2, 1)}, Span{pos(7, 2, 1), pos(7, 2, 1)}},
+	}
+
+	for _, tt := range tests {
+		got := TokenSpan(tt.tok)
+		if got != tt.expected {
+			t.Errorf("wrong span of %q. want=%+v, got=%+v", tt.tok.Literal, tt.expected, got)
+		}
+	}
+}
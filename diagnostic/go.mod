@@ -0,0 +1,7 @@
+module github.com/seblkma/go-himeji/diagnostic
+
+go 1.22.5
+
+replace github.com/seblkma/go-himeji/token => ../token
+
+require github.com/seblkma/go-himeji/token v0.0.0-00010101000000-000000000000
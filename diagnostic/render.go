@@ -0,0 +1,125 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Render writes d for humans, quoting the source line with a caret underline, e.g.
+//
+//	error[P001]: expected next token is =, but got INT instead
+//	 --> codes.txt:2:7
+//	  |
+//	2 | let y 2;
+//	  |       ^
+//	  = help: insert "="
+func Render(w io.Writer, filename, source string, d *Diagnostic) {
+	fmt.Fprintf(w, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+
+	start := d.Span.Start
+	if !start.IsValid() {
+		renderNotes(w, "", d)
+		return
+	}
+
+	gutter := strings.Repeat(" ", len(strconv.Itoa(start.Line)))
+	fmt.Fprintf(w, "%s--> %s:%s\n", gutter, filename, start)
+
+	line, ok := sourceLine(source, start.Line)
+	if ok {
+		fmt.Fprintf(w, "%s |\n", gutter)
+		fmt.Fprintf(w, "%d | %s\n", start.Line, line)
+		fmt.Fprintf(w, "%s | %s\n", gutter, underline(line, start.Column, d.Span))
+	}
+
+	renderNotes(w, gutter, d)
+}
+
+// RenderAll renders the diagnostics one after the other
+func RenderAll(w io.Writer, filename, source string, diagnostics []*Diagnostic) {
+	for _, d := range diagnostics {
+		Render(w, filename, source, d)
+	}
+}
+
+func renderNotes(w io.Writer, gutter string, d *Diagnostic) {
+	for _, note := range d.Notes {
+		fmt.Fprintf(w, "%s = note: %s\n", gutter, note)
+	}
+	if d.Fix != nil {
+		fmt.Fprintf(w, "%s = help: %s\n", gutter, d.Fix.Message)
+	}
+}
+
+// sourceLine returns the line-th line of source, lines start at 1
+func sourceLine(source string, line int) (string, bool) {
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// underline returns the carets below the span on line, the caret starts at column.
+// Tabs before the caret are kept so that it lines up with the source, as are the wide chars, e.g. 日本.
+func underline(line string, column int, span Span) string {
+	chars := []rune(line)
+	var out strings.Builder
+
+	for i := 0; i < column-1; i++ {
+		if i < len(chars) && chars[i] == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteString(strings.Repeat(" ", cellWidth(chars, i)))
+		}
+	}
+
+	// A span running over several lines is underlined to the end of its first line
+	end := len(chars)
+	if span.End.Line == span.Start.Line {
+		end = span.End.Column - 1
+	}
+	width := 0
+	for i := column - 1; i < end; i++ {
+		width += cellWidth(chars, i)
+	}
+	if width < 1 {
+		width = 1
+	}
+	out.WriteString(strings.Repeat("^", width))
+
+	return out.String()
+}
+
+// cellWidth returns the number of terminal cells of the i-th char, East Asian wide chars take 2.
+// Past the end of the line, a char takes 1.
+func cellWidth(chars []rune, i int) int {
+	if i >= len(chars) {
+		return 1
+	}
+	ch := chars[i]
+	switch {
+	case 0xFF61 <= ch && ch <= 0xFFDC: // halfwidth forms, e.g. ｶﾀｶﾅ
+		return 1
+	case 0x3000 <= ch && ch <= 0x303F, 0xFF01 <= ch && ch <= 0xFF60: // CJK punctuation and fullwidth forms
+		return 2
+	case unicode.In(ch, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+		return 2
+	}
+	return 1
+}
+
+// WriteJSON writes the diagnostics as a JSON array for editors, an empty array if there are none
+func WriteJSON(w io.Writer, diagnostics []*Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []*Diagnostic{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diagnostics)
+}
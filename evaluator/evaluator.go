@@ -1,9 +1,13 @@
 package evaluator
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 
 	"github.com/seblkma/go-himeji/ast"
+	"github.com/seblkma/go-himeji/diagnostic"
 	"github.com/seblkma/go-himeji/object"
 	//hparser "github.com/seblkma/go-himeji/parser"
 )
@@ -13,10 +17,24 @@ var (
 	NULL  = &object.Null{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.LoopControl{Break: true}
+	CONTINUE = &object.LoopControl{Break: false}
 )
 
 // Eval evaluates an AST node to our value Object representation
 func Eval(n ast.Node, env *object.Environment) object.Object {
+	result := eval(n, env)
+
+	// An error is located at the innermost node it occurred in
+	if err, ok := result.(*object.Error); ok && !err.Span.Start.IsValid() {
+		err.Span = errorSpan(n)
+	}
+
+	return result
+}
+
+func eval(n ast.Node, env *object.Environment) object.Object {
 	switch node := n.(type) {
 	case *ast.Program:
 		//return evalStatements(node.Statements)
@@ -25,9 +43,18 @@ func Eval(n ast.Node, env *object.Environment) object.Object {
 		return Eval(node.Expression, env)
 	case *ast.IntegerLiteral:
 		// Allocates new Integer values
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.DecimalLiteral:
+		return &object.Decimal{Unscaled: node.Unscaled, Scale: node.Scale}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
 	case *ast.Boolean:
 		// No need to allocate new Boolean objects since they represent the same TRUE or FALSE values
 		return toBooleanObjectInstance(node.Value)
@@ -42,6 +69,9 @@ func Eval(n ast.Node, env *object.Environment) object.Object {
 		if isError(lhs) {
 			return lhs
 		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, lhs, env)
+		}
 		rhs := Eval(node.Right, env)
 		if isError(rhs) {
 			return rhs
@@ -66,6 +96,20 @@ func Eval(n ast.Node, env *object.Environment) object.Object {
 			return valExpr
 		}
 		env.Set(node.Name.Value, valExpr)
+	case *ast.AssignStatement:
+		return evalAssignStatement(node, env)
+	case *ast.IndexAssignStatement:
+		return evalIndexAssignStatement(node, env)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
@@ -129,7 +173,7 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.LOOP_CONTROL_OBJ {
 				return result
 			}
 		}
@@ -138,6 +182,98 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
+// evalWhileStatement runs the loop in Go, unlike recursion it does not grow the Go stack with the number of iterations
+func evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		if result, done := evalLoopBody(node.Body, env); done {
+			return result
+		}
+	}
+}
+
+// evalForStatement binds the init statement in env, like the statements before the loop
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	if node.Init != nil {
+		result := Eval(node.Init, env)
+		if isError(result) {
+			return result
+		}
+	}
+
+	for {
+		if node.Condition != nil {
+			condition := Eval(node.Condition, env)
+			if isError(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return nil
+			}
+		}
+
+		if result, done := evalLoopBody(node.Body, env); done {
+			return result
+		}
+
+		if node.Post != nil {
+			result := Eval(node.Post, env)
+			if isError(result) {
+				return result
+			}
+		}
+	}
+}
+
+// evalForInStatement binds the key and the value of each element in env, see object.Iterator
+func evalForInStatement(node *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	iterator, err := object.Iterate(iterable)
+	if err != nil {
+		err.Span = errorSpan(node.Iterable)
+		return err
+	}
+
+	for {
+		key, value, ok := iterator.Next()
+		if !ok {
+			return nil
+		}
+		if node.Key != nil {
+			env.Set(node.Key.Value, key)
+		}
+		env.Set(node.Value.Value, value)
+
+		if result, done := evalLoopBody(node.Body, env); done {
+			return result
+		}
+	}
+}
+
+// evalLoopBody runs one iteration, it reports whether the loop is done because of a break, a return or an error.
+// A loop has no value, the result is nil unless it is a return value or an error.
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	switch result := Eval(body, env).(type) {
+	case *object.LoopControl:
+		return nil, result.Break
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
 func evalStatements(stmts []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 
@@ -173,13 +309,17 @@ func evalBangOperatorExpression(rhs object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(rhs object.Object) object.Object {
-	if rhs.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", rhs.Type())
-	}
-
 	// Returns the minus value
-	value := rhs.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	switch rhs := rhs.(type) {
+	case *object.Integer, *object.BigInt:
+		return object.NegateInteger(rhs)
+	case *object.Float:
+		return &object.Float{Value: -rhs.Value}
+	case *object.Decimal:
+		return object.NegateDecimal(rhs)
+	default:
+		return newError(diagnostic.UnknownOperator, "unknown operator: -%s", rhs.Type())
+	}
 }
 
 func evalPrefixExpression(op string, rhs object.Object) object.Object {
@@ -189,15 +329,23 @@ func evalPrefixExpression(op string, rhs object.Object) object.Object {
 	case "-":
 		return evalMinusPrefixOperatorExpression(rhs)
 	default:
-		return newError("unknown operator: %s%s", op, rhs.Type())
+		return newError(diagnostic.UnknownOperator, "unknown operator: %s%s", op, rhs.Type())
 	}
 }
 
 func evalInfixExpression(op string, lhs, rhs object.Object) object.Object {
 	switch {
-	case lhs.Type() == object.INTEGER_OBJ && rhs.Type() == object.INTEGER_OBJ:
-		// Both operands are Integer objects
+	case op == ".." || op == "..<":
+		return evalRangeExpression(op, lhs, rhs)
+	case object.IsInteger(lhs) && object.IsInteger(rhs):
+		// Both operands are Integer or BigInt objects
 		return evalInfixIntegerExpression(op, lhs, rhs)
+	case object.HasDecimalOperands(lhs, rhs):
+		// At least one operand is a Decimal, the Integer one is converted to Decimal
+		return evalInfixDecimalExpression(op, lhs, rhs)
+	case object.IsNumber(lhs) && object.IsNumber(rhs):
+		// At least one operand is a Float, the Integer one is converted to Float
+		return evalInfixFloatExpression(op, lhs, rhs)
 	case lhs.Type() == object.STRING_OBJ && rhs.Type() == object.STRING_OBJ:
 		// Both operands are String objects
 		return evalInfixStringExpression(op, lhs, rhs)
@@ -208,37 +356,148 @@ func evalInfixExpression(op string, lhs, rhs object.Object) object.Object {
 		// Reaching here means lhs and rhs are pointers to the Boolean singleton instance(s)
 		return toBooleanObjectInstance(lhs != rhs)
 	case lhs.Type() != rhs.Type():
-		return newError("type mismatch: %s %s %s", lhs.Type(), op, rhs.Type())
+		return newError(diagnostic.TypeMismatch, "type mismatch: %s %s %s", lhs.Type(), op, rhs.Type())
 	default:
-		return newError("unknown operator: %s %s %s", lhs.Type(), op, rhs.Type())
+		return newError(diagnostic.UnknownOperator, "unknown operator: %s %s %s", lhs.Type(), op, rhs.Type())
+	}
+}
+
+// evalRangeExpression creates the lazy Range of 0..n or 0..<n
+func evalRangeExpression(op string, lhs, rhs object.Object) object.Object {
+	r, err := object.NewRange(lhs, rhs, op == "..")
+	if err != nil {
+		return err
+	}
+	return r
+}
+
+// evalLogicalExpression evaluates the rhs of && and || only if the lhs does not decide the result, which is a Boolean
+func evalLogicalExpression(node *ast.InfixExpression, lhs object.Object, env *object.Environment) object.Object {
+	if isTruthy(lhs) == (node.Operator == "||") {
+		return toBooleanObjectInstance(isTruthy(lhs))
+	}
+	rhs := Eval(node.Right, env)
+	if isError(rhs) {
+		return rhs
 	}
+	return toBooleanObjectInstance(isTruthy(rhs))
 }
 
 func evalInfixIntegerExpression(op string, lhs, rhs object.Object) object.Object {
-	leftValue := lhs.(*object.Integer).Value
-	rightValue := rhs.(*object.Integer).Value
+	switch op {
+	case "+":
+		return object.AddIntegers(lhs, rhs)
+	case "-":
+		return object.SubIntegers(lhs, rhs)
+	case "*":
+		return object.MulIntegers(lhs, rhs)
+	case "/":
+		return operationResult(object.DivIntegers(lhs, rhs))
+	case "%":
+		return operationResult(object.ModIntegers(lhs, rhs))
+	case "**":
+		return operationResult(object.PowIntegers(lhs, rhs))
+	case "&":
+		return object.AndIntegers(lhs, rhs)
+	case "|":
+		return object.OrIntegers(lhs, rhs)
+	case "^":
+		return object.XorIntegers(lhs, rhs)
+	case "<<":
+		return operationResult(object.ShiftLeft(lhs, rhs))
+	case ">>":
+		return operationResult(object.ShiftRight(lhs, rhs))
+	case "<":
+		return toBooleanObjectInstance(object.CompareIntegers(lhs, rhs) < 0)
+	case ">":
+		return toBooleanObjectInstance(object.CompareIntegers(lhs, rhs) > 0)
+	case "<=":
+		return toBooleanObjectInstance(object.CompareIntegers(lhs, rhs) <= 0)
+	case ">=":
+		return toBooleanObjectInstance(object.CompareIntegers(lhs, rhs) >= 0)
+	case "==":
+		return toBooleanObjectInstance(object.CompareIntegers(lhs, rhs) == 0)
+	case "!=":
+		return toBooleanObjectInstance(object.CompareIntegers(lhs, rhs) != 0)
+	default:
+		return newError(diagnostic.UnknownOperator, "unknown operator: %s %s %s", lhs.Type(), op, rhs.Type())
+	}
+}
 
+func evalInfixDecimalExpression(op string, lhs, rhs object.Object) object.Object {
 	switch op {
 	case "+":
-		return &object.Integer{Value: leftValue + rightValue}
+		return object.AddDecimals(lhs, rhs)
 	case "-":
-		return &object.Integer{Value: leftValue - rightValue}
+		return object.SubDecimals(lhs, rhs)
 	case "*":
-		return &object.Integer{Value: leftValue * rightValue}
+		return object.MulDecimals(lhs, rhs)
 	case "/":
-		return &object.Integer{Value: leftValue / rightValue}
+		return operationResult(object.DivDecimals(lhs, rhs))
+	case "%":
+		return operationResult(object.ModDecimals(lhs, rhs))
+	case "**":
+		return operationResult(object.PowDecimals(lhs, rhs))
+	case "<":
+		return toBooleanObjectInstance(object.CompareDecimals(lhs, rhs) < 0)
+	case ">":
+		return toBooleanObjectInstance(object.CompareDecimals(lhs, rhs) > 0)
+	case "<=":
+		return toBooleanObjectInstance(object.CompareDecimals(lhs, rhs) <= 0)
+	case ">=":
+		return toBooleanObjectInstance(object.CompareDecimals(lhs, rhs) >= 0)
+	case "==":
+		return toBooleanObjectInstance(object.CompareDecimals(lhs, rhs) == 0)
+	case "!=":
+		return toBooleanObjectInstance(object.CompareDecimals(lhs, rhs) != 0)
+	default:
+		return newError(diagnostic.UnknownOperator, "unknown operator: %s %s %s", lhs.Type(), op, rhs.Type())
+	}
+}
+
+// operationResult turns the error of an arithmetic operation into an Error object
+func operationResult(result object.Object, err error) object.Object {
+	switch {
+	case errors.Is(err, object.ErrDivisionByZero):
+		return newError(diagnostic.DivisionByZero, "%s", err)
+	case err != nil:
+		return newError(diagnostic.InvalidOperand, "%s", err)
+	default:
+		return result
+	}
+}
+
+func evalInfixFloatExpression(op string, lhs, rhs object.Object) object.Object {
+	leftValue := object.ToFloat(lhs)
+	rightValue := object.ToFloat(rhs)
+
+	switch op {
+	case "+":
+		return &object.Float{Value: leftValue + rightValue}
+	case "-":
+		return &object.Float{Value: leftValue - rightValue}
+	case "*":
+		return &object.Float{Value: leftValue * rightValue}
+	case "/":
+		return &object.Float{Value: leftValue / rightValue}
+	case "%":
+		return &object.Float{Value: math.Mod(leftValue, rightValue)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftValue, rightValue)}
 	case "<":
 		return toBooleanObjectInstance(leftValue < rightValue)
 	case ">":
 		return toBooleanObjectInstance(leftValue > rightValue)
+	case "<=":
+		return toBooleanObjectInstance(leftValue <= rightValue)
+	case ">=":
+		return toBooleanObjectInstance(leftValue >= rightValue)
 	case "==":
 		return toBooleanObjectInstance(leftValue == rightValue)
 	case "!=":
 		return toBooleanObjectInstance(leftValue != rightValue)
-	case ">=":
-		return toBooleanObjectInstance(leftValue >= rightValue)
 	default:
-		return newError("unknown operator: %s %s %s", lhs.Type(), op, rhs.Type())
+		return newError(diagnostic.UnknownOperator, "unknown operator: %s %s %s", lhs.Type(), op, rhs.Type())
 	}
 }
 
@@ -249,9 +508,77 @@ func evalInfixStringExpression(op string, lhs, rhs object.Object) object.Object
 	switch op {
 	case "+":
 		return &object.String{Value: leftValue + rightValue}
+	case "==":
+		return toBooleanObjectInstance(leftValue == rightValue)
+	case "!=":
+		return toBooleanObjectInstance(leftValue != rightValue)
 	default:
-		return newError("unknown operator: %s %s %s", lhs.Type(), op, rhs.Type())
+		return newError(diagnostic.UnknownOperator, "unknown operator: %s %s %s", lhs.Type(), op, rhs.Type())
+	}
+}
+
+// evalAssignStatement updates the binding of the name where it is defined, x += 1 is x = x + 1
+func evalAssignStatement(node *ast.AssignStatement, env *object.Environment) object.Object {
+	current, found := env.Get(node.Name.Value)
+	if !found {
+		err := newError(diagnostic.AssignToUndeclared, "assignment to undeclared variable %s", node.Name.Value)
+		err.Span = diagnostic.TokenSpan(node.Name.Token)
+		return err
+	}
+
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	if op := node.Operator(); op != "" {
+		value = evalInfixExpression(op, current, value)
+		if isError(value) {
+			return value
+		}
 	}
+
+	env.Assign(node.Name.Value, value)
+	return nil
+}
+
+// evalIndexAssignStatement updates an array element or a hash value in place, see object.SetIndex.
+// The collection and the index are evaluated once, also for a compound assignment like a[i] += 1.
+func evalIndexAssignStatement(node *ast.IndexAssignStatement, env *object.Environment) object.Object {
+	collection := Eval(node.Target.Left, env)
+	if isError(collection) {
+		return collection
+	}
+	index := Eval(node.Target.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	var current object.Object
+	if node.Operator() != "" {
+		current = evalIndexExpression(collection, index)
+		if isError(current) {
+			return current
+		}
+	}
+
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	if op := node.Operator(); op != "" {
+		value = evalInfixExpression(op, current, value)
+		if isError(value) {
+			return value
+		}
+	}
+
+	if err := object.SetIndex(collection, index, value); err != nil {
+		err.Span = diagnostic.TokenSpan(node.Target.Token)
+		return err
+	}
+	return nil
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
@@ -259,11 +586,11 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 		return obj
 	}
 
-	if builtin, found := builtins[node.Value]; found {
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
 		return builtin
 	}
 
-	return newError("identifier not found: %s", node.Value)
+	return newError(diagnostic.IdentifierNotFound, "identifier not found: %s", node.Value)
 }
 
 func isTruthy(obj object.Object) bool {
@@ -306,6 +633,21 @@ func evalExpressions(exprs []ast.Expression, env *object.Environment) []object.O
 	return results
 }
 
+// evalInterpolatedString joins the parts, as they are inspected
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	var out strings.Builder
+
+	for _, part := range node.Parts {
+		value := Eval(part, env)
+		if isError(value) {
+			return value
+		}
+		out.WriteString(value.Inspect())
+	}
+
+	return &object.String{Value: out.String()}
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrObj := array.(*object.Array)
 	idx := index.(*object.Integer).Value
@@ -318,12 +660,24 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrObj.Elements[idx]
 }
 
+// evalStringIndexExpression indexes the chars of the string, not its bytes
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	chars := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+
+	if idx < 0 || idx >= int64(len(chars)) {
+		return NULL
+	}
+
+	return &object.String{Value: string(chars[idx])}
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObj := hash.(*object.Hashes)
 
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newError(diagnostic.UnusableAsHashKey, "unusable as hash key: %s", index.Type())
 	}
 
 	pair, ok := hashObj.Pairs[key.HashKey()]
@@ -338,10 +692,12 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newError(diagnostic.IndexNotSupported, "index operator not supported: %s", left.Type())
 	}
 }
 
@@ -356,7 +712,9 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			err := newError(diagnostic.UnusableAsHashKey, "unusable as hash key: %s", key.Type())
+			err.Span = errorSpan(nodeKey)
+			return err
 		}
 
 		value := Eval(nodeValue, env)
@@ -371,8 +729,29 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	return &object.Hashes{Pairs: pairs}
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newError(code string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Code: code}
+}
+
+// errorSpan returns the source text to point at for an error in node, the operator of an operation
+func errorSpan(node ast.Node) diagnostic.Span {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		return diagnostic.TokenSpan(node.Token)
+	case *ast.PrefixExpression:
+		return diagnostic.TokenSpan(node.Token)
+	case *ast.IndexExpression:
+		return diagnostic.TokenSpan(node.Token)
+	case *ast.AssignStatement:
+		return diagnostic.TokenSpan(node.Token)
+	case *ast.IndexAssignStatement:
+		return diagnostic.TokenSpan(node.Token)
+	case *ast.CallExpression:
+		return errorSpan(node.Function)
+	case *ast.StringLiteral:
+		return diagnostic.TokenSpan(node.Token)
+	}
+	return diagnostic.TextSpan(node.Pos(), node.TokenLiteral())
 }
 
 func isError(obj object.Object) bool {
@@ -385,15 +764,21 @@ func isError(obj object.Object) bool {
 func executeFunction(fn object.Object, args []object.Object) object.Object {
 	switch function := fn.(type) {
 	case *object.Function:
+		if len(args) != len(function.Parameters) {
+			return newError(diagnostic.WrongArgumentCount, "wrong number of arguments: want=%d, got=%d", len(function.Parameters), len(args))
+		}
 		scopedEnv := scopeFunctionEnv(function, args)
 		// Recursively Eval until the last function body
 		// Unbox it so that evalBlockStatement won’t stop evaluating statements in “outer” functions
 		executed := Eval(function.Body, scopedEnv)
 		return unboxReturnValue(executed)
 	case *object.Builtin:
-		return function.Fn(args...)
+		if result := function.Fn(args...); result != nil {
+			return result
+		}
+		return NULL
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newError(diagnostic.NotAFunction, "not a function: %s", fn.Type())
 	}
 }
 
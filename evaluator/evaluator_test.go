@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/seblkma/go-himeji/diagnostic"
 	"github.com/seblkma/go-himeji/lexer"
 	"github.com/seblkma/go-himeji/object"
 	hparser "github.com/seblkma/go-himeji/parser"
@@ -62,6 +63,7 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"42", 42},
 		{"-12", -12},
 		{"-42", -42},
+		{"0xFF + 0o17 + 0b1 + 1_000", 1271},
 	}
 
 	for _, ti := range testInputs {
@@ -84,6 +86,10 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 > 1", false},
 		{"1 == 1", true},
 		{"1 != 1", false},
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"ab" != "a" + "b"`, false},
 		{"1 == 2", false},
 		{"1 != 2", true},
 		//{"42 >= 0", true}, // InfixExpression does not handle <= or >= yet
@@ -231,6 +237,10 @@ func TestErrorHandling(t *testing.T) {
 			"5 + true; 5;",
 			"type mismatch: INTEGER + BOOLEAN",
 		},
+		{
+			"len(1); 5;",
+			"argument to `len` not supported, got INTEGER",
+		},
 		{
 			"-true",
 			"unknown operator: -BOOLEAN",
@@ -285,6 +295,52 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+// GOFLAGS="-count=1" go test -run TestErrorDiagnostics
+func TestErrorDiagnostics(t *testing.T) {
+	testInputs := []struct {
+		input        string
+		expectedCode string
+		expectedPos  string
+		expectedEnd  int // column
+	}{
+		{"5 + true;", diagnostic.TypeMismatch, "1:3", 4},
+		{"let a = 1;\n  -true", diagnostic.UnknownOperator, "2:3", 4},
+		{"let f = fn(x) {\n  x + uhoh\n};\nf(1)", diagnostic.IdentifierNotFound, "2:7", 11},
+		{"let x = 1; x(2)", diagnostic.NotAFunction, "1:12", 13},
+		{`len(1, 2)`, diagnostic.WrongArgumentCount, "1:1", 4},
+		{`fn(a, b) { a }(1)`, diagnostic.WrongArgumentCount, "1:1", 3},
+		{`first(1)`, diagnostic.InvalidArgument, "1:1", 6},
+		{`{[1]: 2}`, diagnostic.UnusableAsHashKey, "1:2", 3},
+		{`1[0]`, diagnostic.IndexNotSupported, "1:2", 3},
+		{`1 / 0`, diagnostic.DivisionByZero, "1:3", 4},
+		{"let a = 1;\nb = a", diagnostic.AssignToUndeclared, "2:1", 2},
+		{`let s = "a"; s -= 1`, diagnostic.TypeMismatch, "1:16", 18},
+		{"let a = [1, 2];\na[2] = 3", diagnostic.IndexOutOfRange, "2:2", 3},
+		{`let s = "ab"; s[0] = "c"`, diagnostic.IndexNotSupported, "1:16", 17},
+		{`let h = {}; h[[1]] = 1`, diagnostic.UnusableAsHashKey, "1:14", 15},
+	}
+
+	for i, ti := range testInputs {
+		evaluated := testEval(ti.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v) at test [%d]", evaluated, evaluated, i)
+			continue
+		}
+
+		d := errObj.Diagnostic()
+		if d.Code != ti.expectedCode {
+			t.Errorf("wrong code. expected=%s, got=%s at test [%d]", ti.expectedCode, d.Code, i)
+		}
+		if d.Span.Start.String() != ti.expectedPos || d.Span.End.Column != ti.expectedEnd {
+			t.Errorf("wrong span. expected=%s-%d, got=%+v at test [%d]", ti.expectedPos, ti.expectedEnd, d.Span, i)
+		}
+		if d.Message != errObj.Message {
+			t.Errorf("wrong message. expected=%q, got=%q at test [%d]", errObj.Message, d.Message, i)
+		}
+	}
+}
+
 // GOFLAGS="-count=1" go test -run TestLetStatements
 func TestLetStatements(t *testing.T) {
 	testInputs := []struct {
@@ -295,6 +351,134 @@ func TestLetStatements(t *testing.T) {
 		{"let a = 5 * 5; a;", 25},
 		{"let a = 42; let b = a; b;", 42},
 		{"let a = 14; let b = a; let c = a + b + 14; c;", 42},
+		// redefining a name updates the variable, closures see the new value
+		{"let x = 1; let f = fn() { x }; let x = 2; f()", 2},
+		{"let g = fn() { let x = 1; let f = fn() { x }; let x = 2; f() }; g()", 2},
+		{"let g = fn(x) { let f = fn() { x }; let x = x + 1; f() }; g(5)", 6},
+	}
+
+	for _, ti := range testInputs {
+		evaluated := testEval(ti.input)
+		testIntegerObject(t, evaluated, ti.expected)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestAssignStatements
+func TestAssignStatements(t *testing.T) {
+	testInputs := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 1; a = 2; a;", 2},
+		{"let a = 6; a *= 7; a;", 42},
+		{"let a = 1; a <<= 4; a |= 1; a;", 17},
+		{"let a = 1; if (true) { a = 2 }; a;", 2},
+		{"let total = 0; let add = fn(n) { total += n }; add(2); add(3); total;", 5},
+		{"let make = fn() { let c = 0; fn() { c += 1; c } }; let next = make(); next(); next(); next();", 3},
+		{"let make = fn() { let c = 0; fn() { c += 1; c } }; let a = make(); let b = make(); a(); a(); b();", 1},
+		{"let f = fn() { let c = 0; let inc = fn() { c += 1 }; inc(); inc(); c }; f();", 2},
+		{"let f = fn(n) { let g = fn() { fn() { n = n * 2 } }; g()(); g()(); n }; f(5);", 20},
+		{"let pair = fn() { let v = 0; [fn() { v += 1 }, fn() { v }] }; let p = pair(); p[0](); p[0](); p[1]();", 2},
+		{"let a = 1; let f = fn() { let a = 10; a += 1; a }; f() + a;", 12},
+		// a function refers to itself through its variable, which it can assign to
+		{"let f = fn() { f = 3; }; f(); f;", 3},
+		{"let f = fn() { f = 3; f }; f();", 3},
+		{"let g = fn() { let f = fn() { f = 4; 0 }; f(); f }; g();", 4},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; let g = f; f = fn(n) { 99 }; g(1);", 99},
+		{"let g = fn() { let f = fn(n) { if (n == 0) { 0 } else { n + f(n - 1) } }; f(4) }; g();", 10},
+	}
+
+	for _, ti := range testInputs {
+		evaluated := testEval(ti.input)
+		testIntegerObject(t, evaluated, ti.expected)
+	}
+
+	evaluated := testEval("let f = fn() { undeclared = 1 }; f();")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "assignment to undeclared variable undeclared" {
+		t.Errorf("wrong result. got=%T(%+v)", evaluated, evaluated)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestIndexAssignStatements
+func TestIndexAssignStatements(t *testing.T) {
+	testInputs := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; a[1] = 20; a[1];", 20},
+		{"let a = [1, 2, 3]; a[2] *= 5; a[1 + 1];", 15},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"];`, 5},
+		{`let h = {"a": {"b": 1}}; h["a"]["b"] += 41; h["a"]["b"];`, 42},
+		{"let m = [[0, 0], [0, 0]]; m[1][0] = 7; m[1][0] + m[0][0];", 7},
+		// arrays and hashes are shared, not copied
+		{"let a = [1]; let b = a; b[0] = 2; a[0];", 2},
+		{"let a = [1]; let set = fn(arr) { arr[0] = 9 }; set(a); a[0];", 9},
+		{`let a = [1]; let h = {"a": a}; h["a"][0] = 3; a[0];`, 3},
+		{"let a = [1]; let b = push(a, 2); b[0] = 5; a[0];", 1},
+		// the array and the index are evaluated once
+		{"let n = 0; let a = [1, 2]; let f = fn() { n += 1; a }; f()[n] += 10; [n, a[1]];", []int64{1, 12}},
+		{"let i = 0; let a = [1, 2]; a[i] = i + 5; a[0];", 5},
+	}
+
+	for _, ti := range testInputs {
+		evaluated := testEval(ti.input)
+		switch expected := ti.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			arr, ok := evaluated.(*object.Array)
+			if !ok || len(arr.Elements) != len(expected) {
+				t.Errorf("wrong result for %q. got=%T(%+v)", ti.input, evaluated, evaluated)
+				continue
+			}
+			for i, e := range expected {
+				testIntegerObject(t, arr.Elements[i], e)
+			}
+		}
+	}
+
+	evaluated := testEval("let a = [1, 2]; a[-1] = 0;")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "index out of range: -1, array length 2" {
+		t.Errorf("wrong result. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	// An array or a hash can contain itself, it is written as [...] when reached again
+	cycles := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1]; a[0] = a; a;", "[[...]]"},
+		{`let h = {}; h["self"] = h; "${h}";`, "[self: [...]]"},
+	}
+	for _, tt := range cycles {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestLoops
+func TestLoops(t *testing.T) {
+	testInputs := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; while (i < 10) { i += 1 }; i;", 10},
+		{"let sum = 0; for (let i = 1; i <= 100; i += 1) { sum += i }; sum;", 5050},
+		{"let n = 0; for (let i = 0; i < 100000; i += 1) { n += 2 }; n;", 200000},
+		{"let i = 0; while (true) { i += 1; if (i == 5) { break } }; i;", 5},
+		{"let odd = 0; for (let i = 0; i < 10; i += 1) { if (i % 2 == 0) { continue }; odd += i }; odd;", 25},
+		{"let n = 0; for (let i = 0; i < 3; i += 1) { for (let j = 0; j < 3; j += 1) { if (j == i) { break }; n += 1 } }; n;", 3},
+		{"let i = 0; for (;;) { i += 1; if (i > 2) { break } }; i;", 3},
+		{"let i = 0; while (i < 3) { let j = i; i = j + 1; continue; i = 100 }; i;", 3},
+		{"let find = fn(arr, x) { for (let i = 0; i < len(arr); i += 1) { if (arr[i] == x) { return i } }; -1 }; find([5, 6, 7], 7) * 10 + find([1], 9);", 19},
+		{"let f = fn(n) { let total = 0; while (n > 0) { total += n; n -= 1 }; total }; f(4);", 10},
+		{"let a = [0, 0, 0]; for (let i = 0; i < len(a); i += 1) { a[i] = i * i }; a[2];", 4},
+		{"let f = fn() { let fs = [0, 0, 0]; for (let i = 0; i < 3; i += 1) { fs[i] = fn() { i } }; fs[0]() }; f();", 3},
+		{"let i = 0; while (false) { i = 1 }; i;", 0},
 	}
 
 	for _, ti := range testInputs {
@@ -303,6 +487,53 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+// GOFLAGS="-count=1" go test -run TestForInLoops
+func TestForInLoops(t *testing.T) {
+	testInputs := []struct {
+		input    string
+		expected int64
+	}{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x }; sum;", 6},
+		{"let sum = 0; for (i, x in [10, 20, 30]) { sum += i * x }; sum;", 80},
+		{"let sum = 0; for (i in 1..100) { sum += i }; sum;", 5050},
+		{"let sum = 0; for (i in 0..<100) { sum += i }; sum;", 4950},
+		{"let n = 0; for (i in 5..1) { n += 1 }; n;", 0},
+		{"let n = 0; for (i in 3..3) { n += i }; n;", 3},
+		{"let n = 0; for (i in 0..1000000) { if (i == 3) { break }; n += 1 }; n;", 3},
+		{"let odd = 0; for (i in 0..<10) { if (i % 2 == 0) { continue }; odd += i }; odd;", 25},
+		{`let n = 0; for (c in "héllo") { n += 1 }; n;`, 5},
+		{`let s = 0; for (k, v in {"b": 2, "a": 1}) { s = s * 10 + v }; s;`, 12},
+		{`let s = 0; for (k, v in {3: 30, 1: 10, 2: 20}) { s = s * 10 + k }; s;`, 123},
+		{"let n = 0; for (i in 0..<3) { for (j in 0..<3) { if (j == i) { break }; n += 1 } }; n;", 3},
+		{"let last = 0; for (x in [7, 8, 9]) { last = x }; x * 100 + last;", 909},
+		{"let find = fn(arr, x) { for (i, v in arr) { if (v == x) { return i } }; -1 }; find([5, 6, 7], 7) * 10 + find([1], 9);", 19},
+		{"let a = [1, 2, 3]; for (i, x in a) { a[i] = x * x }; a[2];", 9},
+		{"let n = 0; let r = 1..4; for (i in r) { n += i }; for (i in r) { n += i }; n;", 20},
+	}
+
+	for _, ti := range testInputs {
+		evaluated := testEval(ti.input)
+		testIntegerObject(t, evaluated, ti.expected)
+	}
+
+	errorInputs := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"for (x in 5) { }", "cannot iterate over INTEGER"},
+		{"for (x in 1..true) { }", "range bounds must be INTEGER, got INTEGER and BOOLEAN"},
+		{"for (x in [1, 2]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, ti := range errorInputs {
+		evaluated := testEval(ti.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || errObj.Message != ti.expectedMessage {
+			t.Errorf("input %q: wrong result. want=%q, got=%T(%+v)", ti.input, ti.expectedMessage, evaluated, evaluated)
+		}
+	}
+}
+
 // GOFLAGS="-count=1" go test -run TestFunctionObject
 func TestFunctionObject(t *testing.T) {
 	testBody := "{ x + 2; };"
@@ -403,6 +634,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("guten tag!")`, 10},
 		{`len(42)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`push([], 7)[0]`, 7},
+		{`len(push([], 7))`, 1},
 	}
 
 	for _, ti := range testInputs {
@@ -578,6 +811,31 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 6}[false]`,
 			6,
 		},
+		// Equal numbers are the same key
+		{
+			`{1: 5}[1.0]`,
+			5,
+		},
+		{
+			`{1: 5}[1.00d]`,
+			5,
+		},
+		{
+			`{2.0: 5}[2]`,
+			5,
+		},
+		{
+			`{1: 1, 1.0: 2, 1.0d: 3}[1]`,
+			3,
+		},
+		{
+			`{9223372036854775808: 5}[9223372036854775808.0]`,
+			5,
+		},
+		{
+			`{1.5: 5}[1.5d]`,
+			nil,
+		},
 	}
 
 	for _, ti := range testInputs {
@@ -611,3 +869,259 @@ let a = [1, 2, 3, 4];
 let double = fn(x) { x * 2 };
 map(a, double);
 */
+
+// GOFLAGS="-count=1" go test -run TestUnicode
+func TestUnicode(t *testing.T) {
+	testInputs := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("こんにちは")`, 5},
+		{`len("Größe")`, 5},
+		{`"日本語"[1]`, "本"},
+		{`"Straße"[4]`, "ß"},
+		{`"日本語"[3]`, nil},
+		{`first("日本語")`, "日"},
+		{`last("日本語")`, "語"},
+		{`tail("日本語")`, "本語"},
+		{`let 名前 = "ひめじ"; 名前 + "城"`, "ひめじ城"},
+		{`let größe2 = 3; größe2 * 2`, 6},
+	}
+
+	for _, ti := range testInputs {
+		evaluated := testEval(ti.input)
+		switch expected := ti.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("%s: object is not String. got=%T (%+v)", ti.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("%s: String has wrong value. want=%q, got=%q", ti.input, expected, str.Value)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestInterpolatedStrings
+func TestInterpolatedStrings(t *testing.T) {
+	testInputs := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "Himeji"; "hello ${name}!"`, "hello Himeji!"},
+		{`let items = [1, 2]; "${len(items)} items: ${items}"`, "2 items: [1, 2]"},
+		{`"${1 + 1}${true}${if (false) { 1 }}"`, "2truenull"},
+		{`let f = fn(x) { "<${x}>" }; "${f("${f(1)}")}"`, "<<1>>"},
+		{`"${ {"a": 1}["a"] } \${x}"`, "1 ${x}"},
+	}
+
+	for _, ti := range testInputs {
+		evaluated := testEval(ti.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("%s: object is not String. got=%T (%+v)", ti.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != ti.expected {
+			t.Errorf("%s: String has wrong value. want=%q, got=%q", ti.input, ti.expected, str.Value)
+		}
+	}
+
+	evaluated := testEval(`"a ${-true} b"`)
+	if _, ok := evaluated.(*object.Error); !ok {
+		t.Errorf("error in interpolation not returned. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestFloatExpressions
+func TestFloatExpressions(t *testing.T) {
+	testInputs := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1.5", 1.5},
+		{"2.5e2", 250.0},
+		{"-0.5", -0.5},
+		{"1.5 + 1", 2.5},
+		{"1 + 1.5", 2.5},
+		{"10 / 4.0", 2.5},
+		{"10 / 4", int64(2)},
+		{"0.1 * 3 - 0.3 < 0.000001", true},
+		{"2.0 == 2", true},
+		{"2 != 2.5", true},
+		{"1.5 > 1", true},
+		{"int(2.9)", int64(2)},
+		{"float(1) / 4", 0.25},
+		{`float("6.5e1")`, 65.0},
+		{`"${1.0} ${0.25}"`, "1.0 0.25"},
+		{`{1.0: "a"}[1.0]`, "a"},
+		{"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+	}
+
+	for _, ti := range testInputs {
+		evaluated := testEval(ti.input)
+		switch expected := ti.expected.(type) {
+		case float64:
+			float, ok := evaluated.(*object.Float)
+			if !ok || float.Value != expected {
+				t.Errorf("%s: object is not Float %g. got=%T (%+v)", ti.input, expected, evaluated, evaluated)
+			}
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("%s: String has wrong value. want=%q, got=%q", ti.input, expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("%s: wrong error message. want=%q, got=%q", ti.input, expected, obj.Message)
+				}
+			default:
+				t.Errorf("%s: unexpected object. got=%T (%+v)", ti.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestBigIntegers
+func TestBigIntegers(t *testing.T) {
+	testInputs := []struct {
+		input        string
+		expectedType object.ObjectType
+		expected     string // Inspect() of the result
+	}{
+		{"9223372036854775807 + 1", object.BIGINT_OBJ, "9223372036854775808"},
+		{"-9223372036854775807 - 2", object.BIGINT_OBJ, "-9223372036854775809"},
+		{"4294967296 * 4294967296", object.BIGINT_OBJ, "18446744073709551616"},
+		{"-(-9223372036854775807 - 1)", object.BIGINT_OBJ, "9223372036854775808"},
+		{"9223372036854775807 + 1 - 1", object.INTEGER_OBJ, "9223372036854775807"},
+		{"4294967296 * 4294967296 / 4294967296", object.INTEGER_OBJ, "4294967296"},
+		{"9223372036854775807 * 3 > 9223372036854775807", object.BOOLEAN_OBJ, "true"},
+		{"9223372036854775807 + 1 == 4611686018427387904 * 2", object.BOOLEAN_OBJ, "true"},
+		{"9223372036854775807 * 2 + 0.5", object.FLOAT_OBJ, "1.8446744073709552e+19"},
+		{"int(1e20)", object.BIGINT_OBJ, "100000000000000000000"},
+		{"{9223372036854775807 + 1: 1}[9223372036854775807 * 2 / 2 + 1]", object.INTEGER_OBJ, "1"},
+		{"9223372036854775807 * 2 / 0", object.ERROR_OBJ, "ERROR: division by zero"},
+		{"9223372036854775808", object.BIGINT_OBJ, "9223372036854775808"},
+		{"0xFFFF_FFFF_FFFF_FFFF", object.BIGINT_OBJ, "18446744073709551615"},
+		{"-9223372036854775808", object.INTEGER_OBJ, "-9223372036854775808"},
+		{"9223372036854775808 - 1", object.INTEGER_OBJ, "9223372036854775807"},
+		{"{18446744073709551616: 1}[1 << 64]", object.INTEGER_OBJ, "1"},
+	}
+
+	for _, ti := range testInputs {
+		evaluated := testEval(ti.input)
+		if evaluated.Type() != ti.expectedType || evaluated.Inspect() != ti.expected {
+			t.Errorf("%s: wrong result. want=%s %s, got=%s %s", ti.input, ti.expectedType, ti.expected, evaluated.Type(), evaluated.Inspect())
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestDecimalExpressions
+func TestDecimalExpressions(t *testing.T) {
+	testInputs := []struct {
+		input        string
+		expectedType object.ObjectType
+		expected     string // Inspect() of the result
+	}{
+		{"12.50d", object.DECIMAL_OBJ, "12.50"},
+		{"-12.50d", object.DECIMAL_OBJ, "-12.50"},
+		{"0.1d + 0.2d", object.DECIMAL_OBJ, "0.3"},
+		{"0.1d + 0.2d == 0.3d", object.BOOLEAN_OBJ, "true"},
+		{"12.50d + 1", object.DECIMAL_OBJ, "13.50"},
+		{"1 - 0.25d", object.DECIMAL_OBJ, "0.75"},
+		{"19.99d * 3", object.DECIMAL_OBJ, "59.97"},
+		{"1.5d * 1.5d", object.DECIMAL_OBJ, "2.25"},
+		{"10.00d / 4", object.DECIMAL_OBJ, "2.50"},
+		{"1d / 3", object.DECIMAL_OBJ, "0.3333333333333333333333333333"},
+		{"1.50d == 1.5d", object.BOOLEAN_OBJ, "true"},
+		{"2.5d > 2", object.BOOLEAN_OBJ, "true"},
+		{"2.5d < 2.49d", object.BOOLEAN_OBJ, "false"},
+		{"round(2.345d, 2)", object.DECIMAL_OBJ, "2.34"},
+		{`round(2.345d, 2, "half_up")`, object.DECIMAL_OBJ, "2.35"},
+		{"round(2.5d)", object.DECIMAL_OBJ, "2"},
+		{"round(2.5d, 3)", object.DECIMAL_OBJ, "2.500"},
+		{"round(1250, -2)", object.INTEGER_OBJ, "1200"},
+		{"round(2.675, 2)", object.FLOAT_OBJ, "2.67"},
+		{"scale(12.50d)", object.INTEGER_OBJ, "2"},
+		{"scale(12.50d * 1.5d)", object.INTEGER_OBJ, "3"},
+		{"int(-12.9d)", object.INTEGER_OBJ, "-12"},
+		{"float(12.5d)", object.FLOAT_OBJ, "12.5"},
+		{`{1.50d: "a"}[1.5d]`, object.STRING_OBJ, "a"},
+		{`"total: ${19.99d * 3}"`, object.STRING_OBJ, "total: 59.97"},
+		{"1.5d + 1.5", object.ERROR_OBJ, "ERROR: type mismatch: DECIMAL + FLOAT"},
+		{"1.5d / 0", object.ERROR_OBJ, "ERROR: division by zero"},
+		{"scale(1.5)", object.ERROR_OBJ, "ERROR: argument to `scale` must be DECIMAL, got FLOAT"},
+		{`round(1.5d, 0, "sideways")`, object.ERROR_OBJ, "ERROR: unknown rounding mode \"sideways\", want one of ceiling, down, floor, half_down, half_even, half_up, up"},
+	}
+
+	for _, ti := range testInputs {
+		evaluated := testEval(ti.input)
+		if evaluated.Type() != ti.expectedType || evaluated.Inspect() != ti.expected {
+			t.Errorf("%s: wrong result. want=%s %s, got=%s %s", ti.input, ti.expectedType, ti.expected, evaluated.Type(), evaluated.Inspect())
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestOperators
+func TestOperators(t *testing.T) {
+	testInputs := []struct {
+		input        string
+		expectedType object.ObjectType
+		expected     string // Inspect() of the result
+	}{
+		{"7 % 3", object.INTEGER_OBJ, "1"},
+		{"-7 % 3", object.INTEGER_OBJ, "-1"},
+		{"7.5 % 2", object.FLOAT_OBJ, "1.5"},
+		{"10.5d % 3", object.DECIMAL_OBJ, "1.5"},
+		{"2 ** 10", object.INTEGER_OBJ, "1024"},
+		{"2 ** 3 ** 2", object.INTEGER_OBJ, "512"},
+		{"-2 ** 2", object.INTEGER_OBJ, "-4"},
+		{"2 ** 64", object.BIGINT_OBJ, "18446744073709551616"},
+		{"2 ** -1", object.FLOAT_OBJ, "0.5"},
+		{"2.0 ** 0.5 > 1.41", object.BOOLEAN_OBJ, "true"},
+		{"1.5d ** 2", object.DECIMAL_OBJ, "2.25"},
+		{"2d ** -2", object.DECIMAL_OBJ, "0.25"},
+		{"12 & 10", object.INTEGER_OBJ, "8"},
+		{"12 | 10", object.INTEGER_OBJ, "14"},
+		{"12 ^ 10", object.INTEGER_OBJ, "6"},
+		{"1 << 10", object.INTEGER_OBJ, "1024"},
+		{"1 << 64", object.BIGINT_OBJ, "18446744073709551616"},
+		{"-8 >> 1", object.INTEGER_OBJ, "-4"},
+		{"(1 << 64) >> 60", object.INTEGER_OBJ, "16"},
+		{"1 <= 1", object.BOOLEAN_OBJ, "true"},
+		{"2 <= 1", object.BOOLEAN_OBJ, "false"},
+		// the left operand is evaluated first
+		{"let n = 0; let f = fn(x) { n = n * 10 + x; x }; f(1) < f(2); f(3) <= f(4); n", object.INTEGER_OBJ, "1234"},
+		{"1.5 >= 1.5", object.BOOLEAN_OBJ, "true"},
+		{"1.50d <= 1.5d", object.BOOLEAN_OBJ, "true"},
+		{"true && false", object.BOOLEAN_OBJ, "false"},
+		{"true || false", object.BOOLEAN_OBJ, "true"},
+		{"1 && \"a\"", object.BOOLEAN_OBJ, "true"},
+		{"false || 0", object.BOOLEAN_OBJ, "true"},
+		{"false && undefined", object.BOOLEAN_OBJ, "false"},
+		{"true || undefined", object.BOOLEAN_OBJ, "true"},
+		{"true && undefined", object.ERROR_OBJ, "ERROR: identifier not found: undefined"},
+		{"1 % 0", object.ERROR_OBJ, "ERROR: division by zero"},
+		{"1 << -1", object.ERROR_OBJ, "ERROR: negative shift count"},
+		{"1.5 & 1", object.ERROR_OBJ, "ERROR: unknown operator: FLOAT & INTEGER"},
+		{"2d ** 0.5d", object.ERROR_OBJ, "ERROR: exponent 0.5 of a decimal is not an integer"},
+	}
+
+	for _, ti := range testInputs {
+		evaluated := testEval(ti.input)
+		if evaluated.Type() != ti.expectedType || evaluated.Inspect() != ti.expected {
+			t.Errorf("%s: wrong result. want=%s %s, got=%s %s", ti.input, ti.expectedType, ti.expected, evaluated.Type(), evaluated.Inspect())
+		}
+	}
+}
@@ -1,7 +1,13 @@
 module github.com/seblkma/go-himeji/lexer
 
-go 1.22.5
+replace (
+	github.com/seblkma/go-himeji/diagnostic => ../diagnostic
+	github.com/seblkma/go-himeji/token => ../token
+)
 
-replace github.com/seblkma/go-himeji/token => ../token
+go 1.22.5
 
-require github.com/seblkma/go-himeji/token v0.0.0-00010101000000-000000000000
+require (
+	github.com/seblkma/go-himeji/diagnostic v0.0.0-00010101000000-000000000000
+	github.com/seblkma/go-himeji/token v0.0.0-00010101000000-000000000000
+)
@@ -1,35 +1,95 @@
 package lexer
 
-import "github.com/seblkma/go-himeji/token"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/seblkma/go-himeji/diagnostic"
+	"github.com/seblkma/go-himeji/token"
+)
 
 type Lexer struct {
 	input        string
 	position     int  // current position in input (points to current ch)
 	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	ch           rune // current char under examination
+	line         int  // line of the current char
+	column       int  // column of the current char, counted in chars, not bytes
+
+	diagnostics    []*diagnostic.Diagnostic
+	comments       []token.Comment  // all the comments read so far
+	interpolations []*interpolation // the strings whose ${...} is being read, innermost last
+}
+
+// interpolation is a string whose ${...} is being read, the string goes on after the matching }
+type interpolation struct {
+	quote  string         // " or """
+	start  token.Position // of the string
+	braces int            // the { not closed yet in the ${...}
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar() // initialized lexer states
+	if l.ch == byteOrderMark {
+		l.readChar()
+		l.column = 1
+	}
 	return l
 }
 
-// readChar supports ASCII char only, i.e. not Unicode
+const byteOrderMark = '\uFEFF'
+
+// readChar reads the next UTF-8 encoded char of the input
 func (l *Lexer) readChar() {
+	// Moves past the previous char
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
+	size := 0
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, size = utf8.DecodeRuneInString(l.input[l.readPosition:])
+		if l.ch == utf8.RuneError && size == 1 {
+			pos := token.Position{Offset: l.readPosition, Line: l.line, Column: l.column}
+			l.diagnostics = append(l.diagnostics,
+				diagnostic.New(diagnostic.InvalidEncoding, diagnostic.At(pos, 1), "invalid UTF-8 byte %#x", l.input[l.readPosition]))
+		}
 	}
 	l.position = l.readPosition
-	l.readPosition += 1 // next ch
+	l.readPosition += size // next ch
 }
 
+// NextToken returns the next token, with the comments around it as trivia.
+// The comments before a token are its leading ones, those after it on its line its trailing ones.
 func (l *Lexer) NextToken() token.Token {
+	leading := l.readComments()
+
+	tok := l.readToken()
+
+	var trailing []token.Comment
+	if tok.Type != token.EOF {
+		trailing = l.readTrailingComments()
+	}
+
+	if leading != nil || trailing != nil {
+		tok.Trivia = &token.Trivia{Leading: leading, Trailing: trailing}
+	}
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
 
-	l.skipWhiteSpaces()
+	pos := l.pos()
 
 	switch l.ch {
 	case '-':
@@ -45,11 +105,45 @@ func (l *Lexer) NextToken() token.Token {
 	case '/':
 		tok = newToken(token.SLASH, l.ch)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			tok = l.readTwoCharToken(token.POWER)
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			tok = l.readTwoCharToken(token.LT_EQ)
+		case '<':
+			tok = l.readTwoCharToken(token.SHL)
+		default:
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			tok = l.readTwoCharToken(token.GT_EQ)
+		case '>':
+			tok = l.readTwoCharToken(token.SHR)
+		default:
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.readTwoCharToken(token.AND)
+		} else {
+			tok = newToken(token.AMPERSAND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.readTwoCharToken(token.OR)
+		} else {
+			tok = newToken(token.PIPE, l.ch)
+		}
+	case '^':
+		tok = newToken(token.CARET, l.ch)
 	case '=':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -69,15 +163,54 @@ func (l *Lexer) NextToken() token.Token {
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1].braces++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		n := len(l.interpolations)
+		if n > 0 && l.interpolations[n-1].braces == 0 {
+			// Closes the ${...}, the string goes on
+			interp := l.interpolations[n-1]
+			l.readChar()
+			tok = l.readStringPart(interp.start, interp.quote, token.STRING_TAIL, token.STRING_MIDDLE)
+			if tok.Type == token.STRING_TAIL {
+				l.interpolations = l.interpolations[:n-1]
+			}
+			tok.Raw = l.input[pos.Offset:l.position]
+			tok.Pos = pos
+			return tok
+		}
+		if n > 0 {
+			l.interpolations[n-1].braces--
+		}
 		tok = newToken(token.RBRACE, l.ch)
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
 	case '"':
+		quote := `"`
+		if l.hasPrefix(`"""`) {
+			quote = `"""`
+		}
+		l.skipChars(len(quote))
+		if quote == `"""` && l.ch == '\n' {
+			l.readChar() // a newline right after the opening """ is not part of the string
+		}
+
+		tok = l.readStringPart(pos, quote, token.STRING, token.STRING_HEAD)
+		if tok.Type == token.STRING_HEAD {
+			l.interpolations = append(l.interpolations, &interpolation{quote: quote, start: pos})
+		}
+		tok.Raw = l.input[pos.Offset:l.position]
+		tok.Pos = pos
+		return tok
+	case '`':
 		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok.Literal = l.readRawString(pos)
+		tok.Raw = l.input[pos.Offset:l.position]
+		tok.Pos = pos
+		return tok
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -88,46 +221,307 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
 			return tok
+		} else if l.ch == '.' && l.peekChar() == '.' {
+			tok = l.readTwoCharToken(token.RANGE)
+			if l.peekChar() == '<' {
+				l.readChar()
+				tok = token.Token{Type: token.RANGE_EXCLUSIVE, Literal: "..<"}
+			}
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
+			l.diagnostics = append(l.diagnostics,
+				diagnostic.New(diagnostic.IllegalCharacter, diagnostic.TextSpan(pos, string(l.ch)), "illegal character %q", l.ch))
 		}
 	}
 
+	// An operator followed by =, e.g. +=, <<=
+	if assign, ok := token.CompoundAssignments[tok.Type]; ok && l.peekChar() == '=' {
+		l.readChar()
+		tok = token.Token{Type: assign, Literal: tok.Literal + "="}
+	}
+
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
-// readIdentifier reads one char at a time until a non-letter, e.g. nunbers, =, +, (, ), {, }
+// Comments returns the comments read so far, in source order
+func (l *Lexer) Comments() []token.Comment {
+	return l.comments
+}
+
+// Diagnostics returns the problems found in the tokens read so far
+func (l *Lexer) Diagnostics() []*diagnostic.Diagnostic {
+	return l.diagnostics
+}
+
+// pos returns the position of the current char
+func (l *Lexer) pos() token.Position {
+	return token.Position{Offset: l.position, Line: l.line, Column: l.column}
+}
+
+// readIdentifier reads one char at a time until a char that is neither a letter nor a digit, e.g. =, +, (, ), {, }
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an INT, or a FLOAT with a fraction and/or an exponent, e.g. 1.5, 2e10, 6.02e+23,
+// or any of them suffixed with d as a DECIMAL, e.g. 12.50d.
+// An INT may have a 0x, 0o or 0b prefix, and digits of any number may be separated with _, e.g. 1_000_000.
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
-	for isDigit(l.ch) {
+	tokenType := token.TokenType(token.INT)
+
+	if l.ch == '0' && strings.ContainsRune("xXoObB", l.peekChar()) {
+		// The parser checks the digits, so 0b102 is an invalid literal rather than 0b10 followed by 2
 		l.readChar()
+		l.readChar()
+		for isDigit(l.ch) || isASCIILetter(l.ch) || l.ch == '_' {
+			l.readChar()
+		}
+		return l.input[position:l.position], tokenType
 	}
-	return l.input[position:l.position]
+
+	l.readDigits()
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		// The exponent needs digits, 2e alone is the number 2 followed by the identifier e
+		rest := l.input[l.readPosition:]
+		if len(rest) > 0 && (rest[0] == '+' || rest[0] == '-') {
+			rest = rest[1:]
+		}
+		if len(rest) > 0 && isDigit(rune(rest[0])) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+	if l.ch == 'd' && !isLetter(l.peekChar()) && !isDigit(l.peekChar()) {
+		// 2d is a decimal but 2days is the number 2 followed by the identifier days
+		tokenType = token.DECIMAL
+		l.readChar()
+	}
+
+	return l.input[position:l.position], tokenType
+}
+
+// readDigits reads digits and the _ separating them, the parser checks that every _ is between two digits
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+}
+
+// readStringPart reads a string up to its closing quote, or up to a ${ starting an interpolation,
+// and decodes its escape sequences. A " string is on a single line, a """ string may span lines.
+// Returns a token of type end if the string is closed, of type interpolated if it goes on with ${.
+func (l *Lexer) readStringPart(start token.Position, quote string, end, interpolated token.TokenType) token.Token {
+	var out strings.Builder
+
+	for {
+		switch {
+		case l.hasPrefix(quote):
+			l.skipChars(len(quote)) // the closing quote
+			return token.Token{Type: end, Literal: out.String()}
+		case l.hasPrefix("${"):
+			l.skipChars(2)
+			return token.Token{Type: interpolated, Literal: out.String()}
+		case l.ch == 0 || l.ch == '\n' && quote == `"`:
+			l.unterminatedString(start, quote)
+			return token.Token{Type: end, Literal: out.String()}
+		case l.ch == '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteRune(l.ch)
+			l.readChar()
+		}
+	}
+}
+
+// readRawString reads a string between backticks as it is, which may span lines, without escape sequences or interpolations
+func (l *Lexer) readRawString(pos token.Position) string {
+	l.readChar() // the opening `
+	start := l.position
+	for l.ch != '`' {
+		if l.ch == 0 {
+			l.unterminatedString(pos, "`")
+			return l.input[start:l.position]
+		}
+		l.readChar()
+	}
+	value := l.input[start:l.position]
+	l.readChar() // the closing `
+
+	return value
+}
+
+// readEscape decodes the escape sequence starting at the current \ into out
+func (l *Lexer) readEscape(out *strings.Builder) {
+	pos := l.pos()
+	l.readChar() // the \
+
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case '$':
+		out.WriteByte('$') // e.g. "\${not interpolated}"
+	case 'u':
+		l.readUnicodeEscape(pos, out)
+		return
+	case 0, '\n':
+		out.WriteByte('\\') // the string is not terminated, the caller reports it
+		return
+	default:
+		l.diagnostics = append(l.diagnostics,
+			diagnostic.New(diagnostic.InvalidEscape, diagnostic.TextSpan(pos, `\`+string(l.ch)), "unknown escape sequence \\%c", l.ch).
+				AddNote(`the escape sequences are \n, \t, \r, \", \\, \$ and \u{...}`))
+		out.WriteByte('\\')
+		out.WriteRune(l.ch)
+	}
+	l.readChar()
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
+// readUnicodeEscape decodes \u{...}, the code point of a char in 1 to 6 hex digits, e.g. \u{1F600}
+func (l *Lexer) readUnicodeEscape(pos token.Position, out *strings.Builder) {
+	l.readChar() // the u
+
+	valid := l.ch == '{'
+	if valid {
+		l.readChar()
+	}
+	start := l.position
+	for isHexDigit(l.ch) {
+		l.readChar()
+	}
+	digits := l.input[start:l.position]
+	valid = valid && l.ch == '}' && len(digits) >= 1 && len(digits) <= 6
+	if valid {
+		l.readChar()
+	}
+	span := diagnostic.TextSpan(pos, l.input[pos.Offset:l.position])
+
+	if !valid {
+		l.diagnostics = append(l.diagnostics,
+			diagnostic.New(diagnostic.InvalidEscape, span, "invalid Unicode escape sequence").
+				AddNote("write the code point of the char in 1 to 6 hex digits, e.g. \\u{1F600}"))
+		return
+	}
+
+	code, _ := strconv.ParseUint(digits, 16, 32)
+	ch := rune(code)
+	if !utf8.ValidRune(ch) {
+		l.diagnostics = append(l.diagnostics,
+			diagnostic.New(diagnostic.InvalidEscape, span, "escape sequence %s is not a valid Unicode char", l.input[pos.Offset:l.position]))
+		return
+	}
+	out.WriteRune(ch)
+}
+
+func (l *Lexer) unterminatedString(pos token.Position, quote string) {
+	l.diagnostics = append(l.diagnostics,
+		diagnostic.New(diagnostic.UnterminatedString, diagnostic.TextSpan(pos, quote), "string literal is not terminated").
+			SetFix(fmt.Sprintf("insert %s", quote), diagnostic.At(l.pos(), 0), quote))
+}
+
+// hasPrefix reports whether the input continues with prefix from the current char
+func (l *Lexer) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(l.input[l.position:], prefix)
+}
+
+func (l *Lexer) skipChars(n int) {
+	for i := 0; i < n; i++ {
+		l.readChar()
+	}
+}
+
+// readComments skips white spaces and reads the comments up to the next token
+func (l *Lexer) readComments() []token.Comment {
+	var comments []token.Comment
 	for {
+		l.skipWhiteSpaces()
+		if !l.isCommentStart() {
+			return comments
+		}
+		comments = append(comments, l.readComment())
+	}
+}
+
+// readTrailingComments reads the comments after a token up to the end of its line
+func (l *Lexer) readTrailingComments() []token.Comment {
+	var comments []token.Comment
+	for {
+		for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' {
+			l.readChar()
+		}
+		if !l.isCommentStart() {
+			return comments
+		}
+		line := l.line
+		comments = append(comments, l.readComment())
+		if l.ch == '\n' || l.line != line {
+			return comments // up to the end of the line, or a block comment ending on a later line
+		}
+	}
+}
+
+func (l *Lexer) isCommentStart() bool {
+	return l.ch == '#' || l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*')
+}
+
+// readComment reads a comment, line comments stop before the newline
+func (l *Lexer) readComment() token.Comment {
+	pos := l.pos()
+
+	if l.ch == '/' && l.peekChar() == '*' {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		l.readChar()
+		for !(l.ch == '*' && l.peekChar() == '/') {
+			if l.ch == 0 {
+				l.diagnostics = append(l.diagnostics,
+					diagnostic.New(diagnostic.UnterminatedComment, diagnostic.At(pos, 2), "block comment is not terminated").
+						SetFix(`insert "*/"`, diagnostic.At(l.pos(), 0), "*/"))
+				break
+			}
+			l.readChar()
+		}
+		if l.ch != 0 {
+			l.readChar()
+			l.readChar()
+		}
+	} else {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
 		}
 	}
-	return l.input[position:l.position]
+
+	comment := token.Comment{Text: l.input[pos.Offset:l.position], Pos: pos}
+	l.comments = append(l.comments, comment)
+	return comment
 }
 
 func (l *Lexer) skipWhiteSpaces() {
@@ -136,22 +530,41 @@ func (l *Lexer) skipWhiteSpaces() {
 	}
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition] // Looks 1 char ahead
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:]) // Looks 1 char ahead
+	return ch
+}
+
+// readTwoCharToken reads the second char of an operator like <=, the first one is the current char
+func (l *Lexer) readTwoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
-func isLetter(ch byte) bool {
+// isLetter accepts the Unicode letters, e.g. größe, 名前
+func isLetter(ch rune) bool {
 	// Also treats underscore as letter, e.g. foo_bar
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func isDigit(ch byte) bool {
+// isDigit accepts ASCII digits only, numbers are written with them
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
+
+// isHexDigit accepts the digits of a 0x literal, in either case
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func isASCIILetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+}
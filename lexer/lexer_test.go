@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/seblkma/go-himeji/diagnostic"
 	"github.com/seblkma/go-himeji/token"
 )
 
@@ -125,7 +126,7 @@ func TestNextTokenV2(t *testing.T) {
 	};
 
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5; // "/*" would start a block comment
 	5 < 10 > 5;
 
 	if (5 < 10) {
@@ -261,3 +262,533 @@ func TestNextTokenV2(t *testing.T) {
 		}
 	}
 }
+
+// GOFLAGS="-count=1" go test -run TestLoopKeywords
+func TestLoopKeywords(t *testing.T) {
+	input := "while for break continue whiles fork"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.IDENT, "whiles"},
+		{token.IDENT, "fork"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestRangeTokens
+func TestRangeTokens(t *testing.T) {
+	input := "for (x in 1..10) 0..<n 1.5"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.IN, "in"},
+		{token.INT, "1"},
+		{token.RANGE, ".."},
+		{token.INT, "10"},
+		{token.RPAREN, ")"},
+		{token.INT, "0"},
+		{token.RANGE_EXCLUSIVE, "..<"},
+		{token.IDENT, "n"},
+		{token.FLOAT, "1.5"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestNextTokenPositions
+func TestNextTokenPositions(t *testing.T) {
+	input := "let five = 5;\n\tfive != 10;\n\"a b\""
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedOffset int
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 0, 1, 1},
+		{token.IDENT, 4, 1, 5},
+		{token.ASSIGN, 9, 1, 10},
+		{token.INT, 11, 1, 12},
+		{token.SEMICOLON, 12, 1, 13},
+		{token.IDENT, 15, 2, 2},
+		{token.NOT_EQ, 20, 2, 7},
+		{token.INT, 23, 2, 10},
+		{token.SEMICOLON, 25, 2, 12},
+		{token.STRING, 27, 3, 1},
+		{token.EOF, 32, 3, 6},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		expected := token.Position{Offset: tt.expectedOffset, Line: tt.expectedLine, Column: tt.expectedColumn}
+		if tok.Pos != expected {
+			t.Fatalf("tests[%d] - position of %q wrong. expected=%+v, got=%+v", i, tok.Literal, expected, tok.Pos)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestIllegalCharacterDiagnostics
+func TestIllegalCharacterDiagnostics(t *testing.T) {
+	input := "let a = 1 @ 2;\n$"
+
+	l := New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	expected := []string{
+		`1:11: illegal character '@'`,
+		`2:1: illegal character '$'`,
+	}
+
+	diagnostics := l.Diagnostics()
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. want=%d, got=%d", len(expected), len(diagnostics))
+	}
+	for i, d := range diagnostics {
+		if d.Error() != expected[i] {
+			t.Errorf("diagnostics[%d] wrong. want=%q, got=%q", i, expected[i], d.Error())
+		}
+		if d.Code != diagnostic.IllegalCharacter {
+			t.Errorf("diagnostics[%d] has wrong code. want=%s, got=%s", i, diagnostic.IllegalCharacter, d.Code)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestComments
+func TestComments(t *testing.T) {
+	input := `// adds numbers
+# hash comment
+let x = 1 / 2; // half /* not a block */
+/* a block
+   over lines */ x /* inline */ * 3;
+// at the end`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLeading  []string
+		expectedTrailing []string
+	}{
+		{token.LET, []string{"// adds numbers", "# hash comment"}, nil},
+		{token.IDENT, nil, nil},
+		{token.ASSIGN, nil, nil},
+		{token.INT, nil, nil},
+		{token.SLASH, nil, nil},
+		{token.INT, nil, nil},
+		{token.SEMICOLON, nil, []string{"// half /* not a block */"}},
+		{token.IDENT, []string{"/* a block\n   over lines */"}, []string{"/* inline */"}},
+		{token.ASTERISK, nil, nil},
+		{token.INT, nil, nil},
+		{token.SEMICOLON, nil, nil},
+		{token.EOF, []string{"// at the end"}, nil},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		checkComments(t, i, "leading", tt.expectedLeading, tok.Leading())
+		checkComments(t, i, "trailing", tt.expectedTrailing, tok.Trailing())
+	}
+
+	all := l.Comments()
+	if len(all) != 6 {
+		t.Fatalf("wrong number of comments. want=6, got=%d", len(all))
+	}
+	if all[3].Pos.String() != "4:1" || !all[3].IsBlock() || all[2].IsBlock() {
+		t.Errorf("wrong comment. got=%+v", all[3])
+	}
+	if len(l.Diagnostics()) != 0 {
+		t.Errorf("unexpected diagnostics. got=%v", l.Diagnostics())
+	}
+}
+
+func checkComments(t *testing.T, i int, kind string, expected []string, comments []token.Comment) {
+	if len(comments) != len(expected) {
+		t.Fatalf("tests[%d] - wrong number of %s comments. expected=%q, got=%+v", i, kind, expected, comments)
+	}
+	for j, c := range comments {
+		if c.Text != expected[j] {
+			t.Errorf("tests[%d] - %s comment wrong. expected=%q, got=%q", i, kind, expected[j], c.Text)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestUnterminatedComment
+func TestUnterminatedComment(t *testing.T) {
+	l := New("1 /* not closed")
+
+	l.NextToken()
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+
+	diagnostics := l.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want=1, got=%d", len(diagnostics))
+	}
+	d := diagnostics[0]
+	if d.Code != diagnostic.UnterminatedComment || d.Error() != "1:3: block comment is not terminated" {
+		t.Errorf("wrong diagnostic. got=%s %q", d.Code, d.Error())
+	}
+	if d.Fix == nil || d.Fix.Span.Start.Offset != 15 {
+		t.Errorf("wrong fix. got=%+v", d.Fix)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestUnicodeTokens
+func TestUnicodeTokens(t *testing.T) {
+	input := "let 名前 = \"ひめじ城\"; größe_2 @ x\n\uFEFF"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "名前", 5},
+		{token.ASSIGN, "=", 8},
+		{token.STRING, "ひめじ城", 10},
+		{token.SEMICOLON, ";", 16},
+		{token.IDENT, "größe_2", 18},
+		{token.ILLEGAL, "@", 26},
+		{token.IDENT, "x", 28},
+		{token.ILLEGAL, "\uFEFF", 1},
+		{token.EOF, "", 2},
+	}
+
+	l := New("\uFEFF" + input) // a leading byte order mark is skipped
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column of %q wrong. expected=%d, got=%d", i, tok.Literal, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestInvalidEncoding
+func TestInvalidEncoding(t *testing.T) {
+	l := New("\"a\xffb\"")
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	diagnostics := l.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want=1, got=%d", len(diagnostics))
+	}
+	d := diagnostics[0]
+	if d.Code != diagnostic.InvalidEncoding || d.Error() != `1:3: invalid UTF-8 byte 0xff` {
+		t.Errorf("wrong diagnostic. got=%s %q", d.Code, d.Error())
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestStrings
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`"a\nb\tc\"d\\e\r"`, "a\nb\tc\"d\\e\r"},
+		{`"\u{48}\u{e9}\u{65E5}\u{1F600}"`, "Hé日😀"},
+		{"`C:\\dir\\n\n\"raw\"`", "C:\\dir\\n\n\"raw\""},
+		{"\"\"\"\n  line 1\n  \"line\" 2\\t\n\"\"\"", "  line 1\n  \"line\" 2\t\n"},
+		{`""`, ""},
+		{`""""""`, ""},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("input %q: tokentype wrong. expected=%q, got=%q", tt.input, token.STRING, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("input %q: literal wrong. expected=%q, got=%q", tt.input, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Raw != tt.input {
+			t.Errorf("input %q: raw text wrong. got=%q", tt.input, tok.Raw)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("input %q: string not read to its end, next token is %q", tt.input, next.Literal)
+		}
+		if len(l.Diagnostics()) != 0 {
+			t.Errorf("input %q: unexpected diagnostics %v", tt.input, l.Diagnostics())
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestStringDiagnostics
+func TestStringDiagnostics(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedCode string
+		expected     string
+		expectedFix  string
+	}{
+		{"let s = \"abc\nlet t = 1;", diagnostic.UnterminatedString, "1:9: string literal is not terminated", `"`},
+		{"\"\"\"abc", diagnostic.UnterminatedString, "1:1: string literal is not terminated", `"""`},
+		{"`abc", diagnostic.UnterminatedString, "1:1: string literal is not terminated", "`"},
+		{`"a\qb"`, diagnostic.InvalidEscape, `1:3: unknown escape sequence \q`, ""},
+		{`"\u{110000}"`, diagnostic.InvalidEscape, `1:2: escape sequence \u{110000} is not a valid Unicode char`, ""},
+		{`"\u0041"`, diagnostic.InvalidEscape, "1:2: invalid Unicode escape sequence", ""},
+		{`"\u{}"`, diagnostic.InvalidEscape, "1:2: invalid Unicode escape sequence", ""},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		diagnostics := l.Diagnostics()
+		if len(diagnostics) != 1 {
+			t.Fatalf("input %q: wrong number of diagnostics. want=1, got=%v", tt.input, diagnostics)
+		}
+		d := diagnostics[0]
+		if d.Code != tt.expectedCode || d.Error() != tt.expected {
+			t.Errorf("input %q: wrong diagnostic. want=%s %q, got=%s %q", tt.input, tt.expectedCode, tt.expected, d.Code, d.Error())
+		}
+		if tt.expectedFix != "" && (d.Fix == nil || d.Fix.Replacement != tt.expectedFix) {
+			t.Errorf("input %q: wrong fix. got=%+v", tt.input, d.Fix)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestInterpolationTokens
+func TestInterpolationTokens(t *testing.T) {
+	input := `"a ${x + {"k": "${y}"}["k"]} b ${z}" 1`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedRaw     string
+	}{
+		{token.STRING_HEAD, "a ", `"a ${`},
+		{token.IDENT, "x", ""},
+		{token.PLUS, "+", ""},
+		{token.LBRACE, "{", ""},
+		{token.STRING, "k", `"k"`},
+		{token.COLON, ":", ""},
+		{token.STRING_HEAD, "", `"${`},
+		{token.IDENT, "y", ""},
+		{token.STRING_TAIL, "", `}"`},
+		{token.RBRACE, "}", ""},
+		{token.LBRACKET, "[", ""},
+		{token.STRING, "k", `"k"`},
+		{token.RBRACKET, "]", ""},
+		{token.STRING_MIDDLE, " b ", `} b ${`},
+		{token.IDENT, "z", ""},
+		{token.STRING_TAIL, "", `}"`},
+		{token.INT, "1", ""},
+		{token.EOF, "", ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Raw != tt.expectedRaw {
+			t.Fatalf("tests[%d] - raw text wrong. expected=%q, got=%q", i, tt.expectedRaw, tok.Raw)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestOperators
+func TestOperators(t *testing.T) {
+	input := "a % b ** c * d <= e >= f < g > h && i || j & k | l ^ m << n >> o"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "b"},
+		{token.POWER, "**"},
+		{token.IDENT, "c"},
+		{token.ASTERISK, "*"},
+		{token.IDENT, "d"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "e"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "f"},
+		{token.LT, "<"},
+		{token.IDENT, "g"},
+		{token.GT, ">"},
+		{token.IDENT, "h"},
+		{token.AND, "&&"},
+		{token.IDENT, "i"},
+		{token.OR, "||"},
+		{token.IDENT, "j"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "k"},
+		{token.PIPE, "|"},
+		{token.IDENT, "l"},
+		{token.CARET, "^"},
+		{token.IDENT, "m"},
+		{token.SHL, "<<"},
+		{token.IDENT, "n"},
+		{token.SHR, ">>"},
+		{token.IDENT, "o"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestCompoundAssignments
+func TestCompoundAssignments(t *testing.T) {
+	input := "+= -= *= /= %= **= &= |= ^= <<= >>= = == <= >= ** =="
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS_ASSIGN, "-="},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.SLASH_ASSIGN, "/="},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.POWER_ASSIGN, "**="},
+		{token.AMPERSAND_ASSIGN, "&="},
+		{token.PIPE_ASSIGN, "|="},
+		{token.CARET_ASSIGN, "^="},
+		{token.SHL_ASSIGN, "<<="},
+		{token.SHR_ASSIGN, ">>="},
+		{token.ASSIGN, "="},
+		{token.EQ, "=="},
+		{token.LT_EQ, "<="},
+		{token.GT_EQ, ">="},
+		{token.POWER, "**"},
+		{token.EQ, "=="},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestNumbers
+func TestNumbers(t *testing.T) {
+	input := "5 1.5 0.25e3 6.02E+23 1e-9 2e x 3.foo 12.50d 7d 1.5e3d 2days 0xFF_ff 0o17 0B1010 0x1d 0b102 1_000_000 1_000.5 1__0"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "1.5"},
+		{token.FLOAT, "0.25e3"},
+		{token.FLOAT, "6.02E+23"},
+		{token.FLOAT, "1e-9"},
+		{token.INT, "2"},
+		{token.IDENT, "e"},
+		{token.IDENT, "x"},
+		{token.INT, "3"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "foo"},
+		{token.DECIMAL, "12.50d"},
+		{token.DECIMAL, "7d"},
+		{token.DECIMAL, "1.5e3d"},
+		{token.INT, "2"},
+		{token.IDENT, "days"},
+		{token.INT, "0xFF_ff"},
+		{token.INT, "0o17"},
+		{token.INT, "0B1010"},
+		{token.INT, "0x1d"},
+		{token.INT, "0b102"},
+		{token.INT, "1_000_000"},
+		{token.FLOAT, "1_000.5"},
+		{token.INT, "1__0"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/seblkma/go-himeji/diagnostic"
+)
+
+// BuiltinDefinition names a built-in function
+type BuiltinDefinition struct {
+	Name    string
+	Builtin *Builtin
+}
+
+// Builtins is the registry of built-in functions shared by the evaluator and the VM.
+// The order matters, the compiler refers to a built-in function by its index in Builtins.
+// Built-in functions return nil when there is no value, callers turn it into their null.
+var Builtins = []BuiltinDefinition{
+	{
+		Name: "len",
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(diagnostic.WrongArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Array:
+					return &Integer{Value: int64(len(arg.Elements))}
+				case *String:
+					return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))} // chars, not bytes
+				default:
+					return newError(diagnostic.InvalidArgument, "argument to `len` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		Name: "print",
+		// This function prints the arguments to STDOUT
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				for _, arg := range args {
+					fmt.Println(arg.Inspect())
+				}
+				return nil
+			},
+		},
+	},
+	{
+		Name: "first",
+		// This function returns the first array element, use REPL to test, e.g. first(myArr)
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(diagnostic.WrongArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Array:
+					if len(arg.Elements) > 0 {
+						return arg.Elements[0]
+					}
+					return nil
+				case *String:
+					if arg.Value != "" {
+						ch, _ := utf8.DecodeRuneInString(arg.Value)
+						return &String{Value: string(ch)}
+					}
+					return nil
+				default:
+					return newError(diagnostic.InvalidArgument, "argument to `first` must be ARRAY or STRING, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		Name: "last",
+		// This function returns the last array element, use REPL to test, e.g. last(myArr)
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(diagnostic.WrongArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Array:
+					count := len(arg.Elements)
+					if count > 0 {
+						return arg.Elements[count-1]
+					}
+					return nil
+				case *String:
+					if arg.Value != "" {
+						ch, _ := utf8.DecodeLastRuneInString(arg.Value)
+						return &String{Value: string(ch)}
+					}
+					return nil
+				default:
+					return newError(diagnostic.InvalidArgument, "argument to `last` must be ARRAY or STRING, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		Name: "tail",
+		// This function returns a new array containing all array elements except the first, use REPL to test, e.g. tail(myArr)
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(diagnostic.WrongArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Array:
+					count := len(arg.Elements)
+					if count > 0 {
+						newElements := make([]Object, count-1, count-1)
+						copy(newElements, arg.Elements[1:count]) // all except the first
+						return &Array{Elements: newElements}
+					}
+					return nil
+				case *String:
+					if arg.Value != "" {
+						_, size := utf8.DecodeRuneInString(arg.Value)
+						return &String{Value: arg.Value[size:]} // all chars except the first
+					}
+					return nil
+				default:
+					return newError(diagnostic.InvalidArgument, "argument to `tail` must be ARRAY or STRING, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		Name: "push",
+		// This function appends returns a new array, use REPL to test, e.g. push(myArr, 42)
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError(diagnostic.WrongArgumentCount, "wrong number of arguments. got=%d, want=2", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Array:
+					count := len(arg.Elements)
+					newElements := make([]Object, count+1, count+1)
+					copy(newElements, arg.Elements) // all
+					newElements[count] = args[1]    // assign second arg to last array element
+					return &Array{Elements: newElements}
+				default:
+					return newError(diagnostic.InvalidArgument, "argument to `push` must be ARRAY, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		Name: "int",
+		// This function converts a float, truncated toward zero, or a string to an integer, e.g. int(2.9) is 2
+		Builtin: &Builtin{Fn: toInteger},
+	},
+	{
+		Name: "float",
+		// This function converts an integer or a string to a float, e.g. float(1) / 3
+		Builtin: &Builtin{Fn: toFloat},
+	},
+	{
+		Name: "round",
+		// This function rounds a number to a number of digits after the decimal point, 0 by default,
+		// with a rounding mode named in RoundingModes, DefaultDecimalContext.Rounding by default, e.g. round(2.345d, 2, "half_up") is 2.35
+		Builtin: &Builtin{Fn: round},
+	},
+	{
+		Name: "scale",
+		// This function returns the number of digits after the decimal point of a decimal, e.g. scale(12.50d) is 2
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(diagnostic.WrongArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
+				}
+				arg, ok := args[0].(*Decimal)
+				if !ok {
+					return newError(diagnostic.InvalidArgument, "argument to `scale` must be DECIMAL, got %s", args[0].Type())
+				}
+				return &Integer{Value: int64(arg.Scale)}
+			},
+		},
+	},
+}
+
+func toInteger(args ...Object) Object {
+	if len(args) != 1 {
+		return newError(diagnostic.WrongArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	switch arg := args[0].(type) {
+	case *Integer, *BigInt:
+		return arg
+	case *Decimal:
+		return NewInteger(roundRat(arg.rat(), 0, RoundDown))
+	case *Float:
+		if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+			return newError(diagnostic.InvalidArgument, "cannot convert %s to INTEGER", arg.Inspect())
+		}
+		value, _ := big.NewFloat(arg.Value).Int(nil) // truncated toward zero
+		return NewInteger(value)
+	case *String:
+		value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+		if !ok {
+			return newError(diagnostic.InvalidArgument, "cannot convert %q to INTEGER", arg.Value)
+		}
+		return NewInteger(value)
+	default:
+		return newError(diagnostic.InvalidArgument, "argument to `int` must be INTEGER, FLOAT, DECIMAL or STRING, got %s", args[0].Type())
+	}
+}
+
+func toFloat(args ...Object) Object {
+	if len(args) != 1 {
+		return newError(diagnostic.WrongArgumentCount, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	switch arg := args[0].(type) {
+	case *Integer, *BigInt:
+		return &Float{Value: ToFloat(arg)}
+	case *Decimal:
+		value, _ := arg.rat().Float64()
+		return &Float{Value: value}
+	case *Float:
+		return arg
+	case *String:
+		value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+		if err != nil {
+			return newError(diagnostic.InvalidArgument, "cannot convert %q to FLOAT", arg.Value)
+		}
+		return &Float{Value: value}
+	default:
+		return newError(diagnostic.InvalidArgument, "argument to `float` must be INTEGER, FLOAT, DECIMAL or STRING, got %s", args[0].Type())
+	}
+}
+
+func round(args ...Object) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError(diagnostic.WrongArgumentCount, "wrong number of arguments. got=%d, want=1 to 3", len(args))
+	}
+
+	places := 0
+	if len(args) > 1 {
+		arg, ok := args[1].(*Integer)
+		if !ok {
+			return newError(diagnostic.InvalidArgument, "second argument to `round` must be INTEGER, got %s", args[1].Type())
+		}
+		if arg.Value < -maxRoundPlaces || arg.Value > maxRoundPlaces {
+			return newError(diagnostic.InvalidArgument, "cannot round to %d places, out of range", arg.Value)
+		}
+		places = int(arg.Value)
+	}
+
+	mode := DefaultDecimalContext.Rounding
+	if len(args) > 2 {
+		arg, ok := args[2].(*String)
+		if !ok {
+			return newError(diagnostic.InvalidArgument, "third argument to `round` must be STRING, got %s", args[2].Type())
+		}
+		if mode, ok = RoundingModes[arg.Value]; !ok {
+			names := make([]string, 0, len(RoundingModes))
+			for name := range RoundingModes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return newError(diagnostic.InvalidArgument, "unknown rounding mode %q, want one of %s", arg.Value, strings.Join(names, ", "))
+		}
+	}
+
+	switch arg := args[0].(type) {
+	case *Decimal:
+		return RoundDecimal(arg, places, mode)
+	case *Integer, *BigInt:
+		if places >= 0 {
+			return arg
+		}
+		return NewInteger(RoundDecimal(ToDecimal(arg), places, mode).Unscaled)
+	case *Float:
+		if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+			return arg
+		}
+		// Rounds the exact value of the float, e.g. 2.675 is 2.67499999999999982236431605997495353221893310546875, to 2.67
+		rounded := new(big.Rat).SetInt(roundRat(new(big.Rat).SetFloat64(arg.Value), places, mode))
+		if places >= 0 {
+			rounded.Quo(rounded, new(big.Rat).SetInt(pow10(places)))
+		} else {
+			rounded.Mul(rounded, new(big.Rat).SetInt(pow10(-places)))
+		}
+		value, _ := rounded.Float64()
+		return &Float{Value: value}
+	default:
+		return newError(diagnostic.InvalidArgument, "argument to `round` must be INTEGER, FLOAT or DECIMAL, got %s", args[0].Type())
+	}
+}
+
+// maxRoundPlaces bounds the places of round, round(x, 1000000000) would not fit in memory
+const maxRoundPlaces = 10000
+
+// GetBuiltinByName returns the built-in function registered as name, or nil
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+// MaxBuiltins is the number of built-in functions the bytecode can address,
+// the operand of OpGetBuiltin is a single byte
+const MaxBuiltins = 256
+
+// RegisterBuiltin lets a host add its own built-in function, or replace an existing one.
+// Returns the index of the built-in function in Builtins, or an error once MaxBuiltins are registered.
+// Register before compiling, the compiler only knows about the built-in functions registered so far.
+func RegisterBuiltin(name string, fn BuiltInFunction) (int, error) {
+	for i, def := range Builtins {
+		if def.Name == name {
+			Builtins[i].Builtin = &Builtin{Fn: fn}
+			return i, nil
+		}
+	}
+
+	if len(Builtins) >= MaxBuiltins {
+		return -1, fmt.Errorf("cannot register builtin %s: already %d builtins registered", name, MaxBuiltins)
+	}
+
+	Builtins = append(Builtins, BuiltinDefinition{Name: name, Builtin: &Builtin{Fn: fn}})
+	return len(Builtins) - 1, nil
+}
+
+func newError(code string, format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Code: code}
+}
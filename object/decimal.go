@@ -0,0 +1,278 @@
+package object
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"strings"
+)
+
+// A wrapper for exact base-10 numbers, the value is Unscaled × 10^-Scale, e.g. 12.50 is 1250 with scale 2.
+// Addition, subtraction and multiplication are exact and keep the scale, e.g. 12.50 + 1 is 13.50,
+// only a division may round, as configured by DefaultDecimalContext.
+type Decimal struct {
+	Unscaled *big.Int
+	Scale    int // never negative
+}
+
+// Implements the Object interface
+func (d *Decimal) Type() ObjectType { return DECIMAL_OBJ }
+
+// Implements the Object interface, the digits after the decimal point are kept, e.g. 12.50
+func (d *Decimal) Inspect() string {
+	s := new(big.Int).Abs(d.Unscaled).String()
+	if d.Scale > 0 {
+		if len(s) <= d.Scale {
+			s = strings.Repeat("0", d.Scale-len(s)+1) + s
+		}
+		s = s[:len(s)-d.Scale] + "." + s[len(s)-d.Scale:]
+	}
+	if d.Unscaled.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// Implements Hashable, equal values are the same key whatever their scales, e.g. 1.5 and 1.50
+func (d *Decimal) HashKey() HashKey {
+	unscaled, scale := new(big.Int).Set(d.Unscaled), d.Scale
+	ten, digit := big.NewInt(10), new(big.Int)
+	for scale > 0 {
+		quotient, _ := new(big.Int).QuoRem(unscaled, ten, digit)
+		if digit.Sign() != 0 {
+			break
+		}
+		unscaled, scale = quotient, scale-1
+	}
+	if scale == 0 {
+		// An integral decimal has the key of the equal integer, since 1 == 1.0d
+		return integerHashKey(unscaled)
+	}
+
+	hFn := fnv.New64a()
+	hFn.Write([]byte{byte(unscaled.Sign() + 1)})
+	hFn.Write(binary.BigEndian.AppendUint64(nil, uint64(scale)))
+	hFn.Write(unscaled.Bytes())
+	return HashKey{Type: d.Type(), Value: hFn.Sum64()}
+}
+
+// RoundingMode is how a decimal is rounded to fewer digits
+type RoundingMode int
+
+const (
+	RoundHalfEven RoundingMode = iota // to the nearest, a tie to the even neighbour, i.e. banker's rounding
+	RoundHalfUp                       // to the nearest, a tie away from zero
+	RoundHalfDown                     // to the nearest, a tie toward zero
+	RoundUp                           // away from zero
+	RoundDown                         // toward zero, i.e. truncation
+	RoundCeiling                      // toward +Inf
+	RoundFloor                        // toward -Inf
+)
+
+// RoundingModes names the rounding modes for the round builtin, e.g. round(x, 2, "half_up")
+var RoundingModes = map[string]RoundingMode{
+	"half_even": RoundHalfEven,
+	"half_up":   RoundHalfUp,
+	"half_down": RoundHalfDown,
+	"up":        RoundUp,
+	"down":      RoundDown,
+	"ceiling":   RoundCeiling,
+	"floor":     RoundFloor,
+}
+
+// DecimalContext configures the decimal operations which cannot always be exact
+type DecimalContext struct {
+	Precision int          // significant digits of a quotient which does not terminate, e.g. 1 / 3
+	Rounding  RoundingMode // of such a quotient, and of round() without a mode
+}
+
+// DefaultDecimalContext is used by the evaluator, the VM and the builtins, a host may change it before running a program
+var DefaultDecimalContext = DecimalContext{Precision: 28, Rounding: RoundHalfEven}
+
+// HasDecimalOperands reports whether a binary operation on a and b is a decimal one,
+// i.e. one operand is a Decimal and the other one a Decimal, an Integer or a BigInt
+func HasDecimalOperands(a, b Object) bool {
+	if a.Type() != DECIMAL_OBJ && b.Type() != DECIMAL_OBJ {
+		return false
+	}
+	return (a.Type() == DECIMAL_OBJ || IsInteger(a)) && (b.Type() == DECIMAL_OBJ || IsInteger(b))
+}
+
+// ToDecimal returns the value of a Decimal, an Integer or a BigInt as Decimal
+func ToDecimal(obj Object) *Decimal {
+	if d, ok := obj.(*Decimal); ok {
+		return d
+	}
+	return &Decimal{Unscaled: toBig(obj), Scale: 0}
+}
+
+// AddDecimals returns a + b, exactly, with the larger scale of the operands
+func AddDecimals(a, b Object) Object {
+	x, y, scale := alignDecimals(ToDecimal(a), ToDecimal(b))
+	return &Decimal{Unscaled: x.Add(x, y), Scale: scale}
+}
+
+// SubDecimals returns a - b, exactly, with the larger scale of the operands
+func SubDecimals(a, b Object) Object {
+	x, y, scale := alignDecimals(ToDecimal(a), ToDecimal(b))
+	return &Decimal{Unscaled: x.Sub(x, y), Scale: scale}
+}
+
+// MulDecimals returns a * b, exactly, with the sum of the scales of the operands
+func MulDecimals(a, b Object) Object {
+	x, y := ToDecimal(a), ToDecimal(b)
+	return &Decimal{Unscaled: new(big.Int).Mul(x.Unscaled, y.Unscaled), Scale: x.Scale + y.Scale}
+}
+
+// DivDecimals returns a / b with the smallest scale, but at least the larger one of the operands, which makes it exact.
+// A quotient which does not terminate, e.g. 1 / 3, is rounded to DefaultDecimalContext.
+func DivDecimals(a, b Object) (Object, error) {
+	x, y := ToDecimal(a), ToDecimal(b)
+	if y.Unscaled.Sign() == 0 {
+		return nil, ErrDivisionByZero
+	}
+
+	quotient := new(big.Rat).Quo(x.rat(), y.rat())
+	scale := max(x.Scale, y.Scale)
+	if quotient.Sign() == 0 {
+		return &Decimal{Unscaled: new(big.Int), Scale: scale}, nil
+	}
+
+	ctx := DefaultDecimalContext
+	limit := max(scale, ctx.Precision-1-exponent(quotient))
+	for ; scale < limit; scale++ {
+		if new(big.Rat).Mul(quotient, new(big.Rat).SetInt(pow10(scale))).IsInt() {
+			break
+		}
+	}
+	return &Decimal{Unscaled: roundRat(quotient, scale, ctx.Rounding), Scale: scale}, nil
+}
+
+// ModDecimals returns the remainder of a / b, exactly, with the sign of a and the larger scale of the operands,
+// e.g. 10.5 % 3 is 1.5
+func ModDecimals(a, b Object) (Object, error) {
+	x, y, scale := alignDecimals(ToDecimal(a), ToDecimal(b))
+	if y.Sign() == 0 {
+		return nil, ErrDivisionByZero
+	}
+	return &Decimal{Unscaled: x.Rem(x, y), Scale: scale}, nil
+}
+
+// PowDecimals returns a ** b, where b has an integer value. It is exact with the scale of a times b when b is not negative,
+// e.g. 1.5 ** 2 is 2.25, otherwise it is 1 / (a ** -b).
+func PowDecimals(a, b Object) (Object, error) {
+	x, y := ToDecimal(a), ToDecimal(b)
+	exp := y.rat()
+	if !exp.IsInt() {
+		return nil, fmt.Errorf("exponent %s of a decimal is not an integer", b.Inspect())
+	}
+
+	n := exp.Num()
+	if n.Sign() < 0 {
+		positive, err := PowDecimals(x, NewInteger(new(big.Int).Neg(n)))
+		if err != nil {
+			return nil, err
+		}
+		return DivDecimals(&Integer{Value: 1}, positive)
+	}
+
+	if !n.IsInt64() || int64(x.Scale)*n.Int64() > MaxIntegerBits ||
+		x.Unscaled.CmpAbs(big.NewInt(1)) > 0 && n.Int64() > MaxIntegerBits/int64(x.Unscaled.BitLen()-1) {
+		return nil, fmt.Errorf("decimal too large, %s ** %s has more than %d bits", a.Inspect(), b.Inspect(), MaxIntegerBits)
+	}
+	return &Decimal{Unscaled: new(big.Int).Exp(x.Unscaled, n, nil), Scale: x.Scale * int(n.Int64())}, nil
+}
+
+// NegateDecimal returns -a
+func NegateDecimal(a *Decimal) *Decimal {
+	return &Decimal{Unscaled: new(big.Int).Neg(a.Unscaled), Scale: a.Scale}
+}
+
+// CompareDecimals returns -1, 0 or +1 as a is less than, equal to or greater than b, whatever their scales
+func CompareDecimals(a, b Object) int {
+	x, y, _ := alignDecimals(ToDecimal(a), ToDecimal(b))
+	return x.Cmp(y)
+}
+
+// RoundDecimal returns d rounded to places digits after the decimal point, which is its new scale.
+// Negative places round to tens, hundreds, etc. with a scale of 0, e.g. 1250 rounded to -2 places is 1300 (half_up).
+func RoundDecimal(d *Decimal, places int, mode RoundingMode) *Decimal {
+	if places >= 0 {
+		return &Decimal{Unscaled: roundRat(d.rat(), places, mode), Scale: places}
+	}
+	unscaled := roundRat(new(big.Rat).Quo(d.rat(), new(big.Rat).SetInt(pow10(-places))), 0, mode)
+	return &Decimal{Unscaled: unscaled.Mul(unscaled, pow10(-places)), Scale: 0}
+}
+
+// rat returns the value of d as big.Rat
+func (d *Decimal) rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.Unscaled, pow10(d.Scale))
+}
+
+// alignDecimals returns the unscaled values of a and b rescaled to the larger scale of both, which the caller may modify
+func alignDecimals(a, b *Decimal) (*big.Int, *big.Int, int) {
+	scale := max(a.Scale, b.Scale)
+	x := new(big.Int).Mul(a.Unscaled, pow10(scale-a.Scale))
+	y := new(big.Int).Mul(b.Unscaled, pow10(scale-b.Scale))
+	return x, y, scale
+}
+
+// roundRat returns r × 10^scale rounded to an integer, scale may be negative
+func roundRat(r *big.Rat, scale int, mode RoundingMode) *big.Int {
+	scaled := new(big.Rat).Set(r)
+	if scale >= 0 {
+		scaled.Mul(scaled, new(big.Rat).SetInt(pow10(scale)))
+	} else {
+		scaled.Quo(scaled, new(big.Rat).SetInt(pow10(-scale)))
+	}
+
+	remainder := new(big.Int)
+	quotient, _ := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), remainder) // truncated toward zero
+	if remainder.Sign() == 0 {
+		return quotient
+	}
+
+	sign := scaled.Sign()
+	half := new(big.Int).Abs(remainder)
+	half.Lsh(half, 1)
+	tie := half.Cmp(scaled.Denom()) // <0 below half, 0 half way, >0 above half
+
+	var awayFromZero bool
+	switch mode {
+	case RoundHalfEven:
+		awayFromZero = tie > 0 || tie == 0 && quotient.Bit(0) == 1
+	case RoundHalfUp:
+		awayFromZero = tie >= 0
+	case RoundHalfDown:
+		awayFromZero = tie > 0
+	case RoundUp:
+		awayFromZero = true
+	case RoundCeiling:
+		awayFromZero = sign > 0
+	case RoundFloor:
+		awayFromZero = sign < 0
+	}
+	if awayFromZero {
+		quotient.Add(quotient, big.NewInt(int64(sign)))
+	}
+	return quotient
+}
+
+// exponent returns e such that 10^e <= |r| < 10^(e+1), r is not zero
+func exponent(r *big.Rat) int {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	e := len(num.String()) - len(den.String())
+	// |r| < 10^e means the leading digit is one place lower
+	if e >= 0 && num.Cmp(new(big.Int).Mul(den, pow10(e))) < 0 ||
+		e < 0 && new(big.Int).Mul(num, pow10(-e)).Cmp(den) < 0 {
+		e--
+	}
+	return e
+}
+
+// pow10 returns 10^n, n is not negative
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -2,11 +2,17 @@ module github.com/seblkma/go-himeji/object
 
 replace (
 	github.com/seblkma/go-himeji/ast => ../ast
+	github.com/seblkma/go-himeji/diagnostic => ../diagnostic
+	github.com/seblkma/go-himeji/opcodes => ../opcodes
 	github.com/seblkma/go-himeji/token => ../token
 )
 
 go 1.22.5
 
-require github.com/seblkma/go-himeji/ast v0.0.0-00010101000000-000000000000
+require (
+	github.com/seblkma/go-himeji/ast v0.0.0-00010101000000-000000000000
+	github.com/seblkma/go-himeji/diagnostic v0.0.0-00010101000000-000000000000
+	github.com/seblkma/go-himeji/opcodes v0.0.0-00010101000000-000000000000
+)
 
 require github.com/seblkma/go-himeji/token v0.0.0-00010101000000-000000000000 // indirect
@@ -0,0 +1,277 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+	"math/bits"
+)
+
+// A wrapper for the integers which do not fit in int64.
+// Integer arithmetic promotes its result to BigInt on overflow, and demotes it to Integer when it fits again,
+// so a BigInt value is always out of the int64 range.
+type BigInt struct {
+	Value *big.Int
+}
+
+// Implements the Object interface
+func (b *BigInt) Type() ObjectType { return BIGINT_OBJ }
+
+// Implements the Object interface
+func (b *BigInt) Inspect() string { return b.Value.String() }
+
+// Implements Hashable
+func (b *BigInt) HashKey() HashKey {
+	hFn := fnv.New64a()
+	hFn.Write([]byte{byte(b.Value.Sign() + 1)})
+	hFn.Write(b.Value.Bytes())
+	return HashKey{Type: b.Type(), Value: hFn.Sum64()}
+}
+
+// integerHashKey returns the hash key of the integer v, which the equal Float and Decimal numbers share
+func integerHashKey(v *big.Int) HashKey {
+	return NewInteger(v).(Hashable).HashKey()
+}
+
+// ErrDivisionByZero is returned by DivIntegers for a zero divisor
+var ErrDivisionByZero = errors.New("division by zero")
+
+// ErrNegativeShift is returned by ShiftLeft and ShiftRight for a negative shift count
+var ErrNegativeShift = errors.New("negative shift count")
+
+// MaxIntegerBits bounds the results of << and **, 1 << 1000000000 would not fit in memory
+const MaxIntegerBits = 1 << 20
+
+// NewInteger returns an Integer if v fits in int64, otherwise a BigInt
+func NewInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInt{Value: v}
+}
+
+// IsInteger reports whether obj is an Integer or a BigInt
+func IsInteger(obj Object) bool {
+	return obj.Type() == INTEGER_OBJ || obj.Type() == BIGINT_OBJ
+}
+
+// IsNumber reports whether obj is an Integer, a BigInt or a Float
+func IsNumber(obj Object) bool {
+	return IsInteger(obj) || obj.Type() == FLOAT_OBJ
+}
+
+// ToFloat returns the value of a number as float64, the nearest one for a BigInt
+func ToFloat(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value)
+	case *BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	default:
+		return obj.(*Float).Value
+	}
+}
+
+// toBig returns the value of an Integer or a BigInt as big.Int, which the caller may modify
+func toBig(obj Object) *big.Int {
+	if i, ok := obj.(*Integer); ok {
+		return big.NewInt(i.Value)
+	}
+	return new(big.Int).Set(obj.(*BigInt).Value)
+}
+
+// AddIntegers returns a + b for Integer or BigInt operands
+func AddIntegers(a, b Object) Object {
+	x, y, small := int64s(a, b)
+	if small {
+		sum := x + y
+		if (sum > x) == (y > 0) { // no overflow
+			return &Integer{Value: sum}
+		}
+	}
+	return NewInteger(new(big.Int).Add(toBig(a), toBig(b)))
+}
+
+// SubIntegers returns a - b for Integer or BigInt operands
+func SubIntegers(a, b Object) Object {
+	x, y, small := int64s(a, b)
+	if small {
+		diff := x - y
+		if (diff < x) == (y > 0) { // no overflow
+			return &Integer{Value: diff}
+		}
+	}
+	return NewInteger(new(big.Int).Sub(toBig(a), toBig(b)))
+}
+
+// MulIntegers returns a * b for Integer or BigInt operands
+func MulIntegers(a, b Object) Object {
+	x, y, small := int64s(a, b)
+	if small && fitsProduct(x, y) {
+		return &Integer{Value: x * y}
+	}
+	return NewInteger(new(big.Int).Mul(toBig(a), toBig(b)))
+}
+
+// DivIntegers returns a / b, truncated toward zero, for Integer or BigInt operands
+func DivIntegers(a, b Object) (Object, error) {
+	if y, ok := b.(*Integer); ok && y.Value == 0 { // a BigInt is never zero
+		return nil, ErrDivisionByZero
+	}
+	x, y, small := int64s(a, b)
+	if small && !(x == math.MinInt64 && y == -1) { // the only overflowing division
+		return &Integer{Value: x / y}, nil
+	}
+	return NewInteger(new(big.Int).Quo(toBig(a), toBig(b))), nil
+}
+
+// ModIntegers returns the remainder of a / b, which has the sign of a, for Integer or BigInt operands
+func ModIntegers(a, b Object) (Object, error) {
+	if y, ok := b.(*Integer); ok && y.Value == 0 {
+		return nil, ErrDivisionByZero
+	}
+	x, y, small := int64s(a, b)
+	if small {
+		return &Integer{Value: x % y}, nil // math.MinInt64 % -1 is 0 in Go
+	}
+	return NewInteger(new(big.Int).Rem(toBig(a), toBig(b))), nil
+}
+
+// AndIntegers returns a & b for Integer or BigInt operands, a negative BigInt behaves as in two's complement
+func AndIntegers(a, b Object) Object {
+	if x, y, small := int64s(a, b); small {
+		return &Integer{Value: x & y}
+	}
+	return NewInteger(new(big.Int).And(toBig(a), toBig(b)))
+}
+
+// OrIntegers returns a | b for Integer or BigInt operands
+func OrIntegers(a, b Object) Object {
+	if x, y, small := int64s(a, b); small {
+		return &Integer{Value: x | y}
+	}
+	return NewInteger(new(big.Int).Or(toBig(a), toBig(b)))
+}
+
+// XorIntegers returns a ^ b for Integer or BigInt operands
+func XorIntegers(a, b Object) Object {
+	if x, y, small := int64s(a, b); small {
+		return &Integer{Value: x ^ y}
+	}
+	return NewInteger(new(big.Int).Xor(toBig(a), toBig(b)))
+}
+
+// ShiftLeft returns a << b for Integer or BigInt operands, promoting to BigInt rather than losing bits
+func ShiftLeft(a, b Object) (Object, error) {
+	n, err := shiftCount(b)
+	if err != nil {
+		return nil, err
+	}
+	x := toBig(a)
+	if x.BitLen()+n > MaxIntegerBits {
+		return nil, fmt.Errorf("integer too large, %s << %d has more than %d bits", a.Inspect(), n, MaxIntegerBits)
+	}
+	return NewInteger(x.Lsh(x, uint(n))), nil
+}
+
+// ShiftRight returns a >> b for Integer or BigInt operands, an arithmetic shift, e.g. -8 >> 1 is -4
+func ShiftRight(a, b Object) (Object, error) {
+	n, err := shiftCount(b)
+	if err != nil {
+		return nil, err
+	}
+	if x, ok := a.(*Integer); ok {
+		return &Integer{Value: x.Value >> min(n, 63)}, nil
+	}
+	x := toBig(a)
+	return NewInteger(x.Rsh(x, uint(n))), nil
+}
+
+// PowIntegers returns a ** b for Integer or BigInt operands, exact when b is not negative,
+// otherwise a Float like with a Float operand, e.g. 2 ** -1 is 0.5
+func PowIntegers(a, b Object) (Object, error) {
+	if CompareIntegers(b, &Integer{Value: 0}) < 0 {
+		return &Float{Value: math.Pow(ToFloat(a), ToFloat(b))}, nil
+	}
+	x, y := toBig(a), toBig(b)
+	if x.CmpAbs(big.NewInt(1)) > 0 && (!y.IsInt64() || y.Int64() > MaxIntegerBits/int64(x.BitLen()-1)) {
+		return nil, fmt.Errorf("integer too large, %s ** %s has more than %d bits", a.Inspect(), b.Inspect(), MaxIntegerBits)
+	}
+	return NewInteger(x.Exp(x, y, nil)), nil
+}
+
+// shiftCount returns the value of the shift count obj, which is an Integer or a BigInt
+func shiftCount(obj Object) (int, error) {
+	if CompareIntegers(obj, &Integer{Value: 0}) < 0 {
+		return 0, ErrNegativeShift
+	}
+	if CompareIntegers(obj, &Integer{Value: MaxIntegerBits}) > 0 {
+		return 0, fmt.Errorf("shift count %s too large, at most %d", obj.Inspect(), MaxIntegerBits)
+	}
+	return int(obj.(*Integer).Value), nil
+}
+
+// NegateInteger returns -a for an Integer or BigInt operand
+func NegateInteger(a Object) Object {
+	if i, ok := a.(*Integer); ok && i.Value != math.MinInt64 {
+		return &Integer{Value: -i.Value}
+	}
+	return NewInteger(new(big.Int).Neg(toBig(a)))
+}
+
+// CompareIntegers returns -1, 0 or +1 as a is less than, equal to or greater than b, for Integer or BigInt operands
+func CompareIntegers(a, b Object) int {
+	x, y, small := int64s(a, b)
+	if small {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return toBig(a).Cmp(toBig(b))
+}
+
+// int64s returns the values of a and b if both are Integer
+func int64s(a, b Object) (int64, int64, bool) {
+	x, ok := a.(*Integer)
+	if !ok {
+		return 0, 0, false
+	}
+	y, ok := b.(*Integer)
+	if !ok {
+		return 0, 0, false
+	}
+	return x.Value, y.Value, true
+}
+
+// fitsProduct reports whether x * y fits in int64
+func fitsProduct(x, y int64) bool {
+	if x == 0 || y == 0 {
+		return true
+	}
+	if x == math.MinInt64 || y == math.MinInt64 {
+		return x == 1 || y == 1
+	}
+	hi, lo := bits.Mul64(uint64(abs(x)), uint64(abs(y)))
+	if hi != 0 {
+		return false
+	}
+	if (x < 0) != (y < 0) {
+		return lo <= 1<<63 // down to math.MinInt64
+	}
+	return lo <= math.MaxInt64
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,204 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/seblkma/go-himeji/diagnostic"
+)
+
+// Iterable is implemented by the objects a for ... in loop iterates over, e.g. for (x in arr).
+// A new collection type plugs into the loops of the evaluator and the VM by implementing it.
+type Iterable interface {
+	Iterator() Iterator
+}
+
+// Iterator yields the elements of an Iterable one at a time. It is an Object, the VM keeps it on its stack during a loop.
+type Iterator interface {
+	Object
+	// Next returns the next element and its key, ok is false when there are no more elements.
+	// for (x in c) binds the element, for (k, x in c) binds the key too, e.g. the index of an array element.
+	Next() (key, value Object, ok bool)
+}
+
+// Iterate returns an iterator over obj, the evaluator and the VM share it so that both iterate alike
+func Iterate(obj Object) (Iterator, *Error) {
+	iterable, ok := obj.(Iterable)
+	if !ok {
+		return nil, newError(diagnostic.NotIterable, "cannot iterate over %s", obj.Type())
+	}
+	return iterable.Iterator(), nil
+}
+
+// Range is the integers from Start up to End, including End if Inclusive, e.g. 0..3 or 0..<3.
+// It is lazy, iterating over 0..1000000 does not allocate the numbers up front. A range with End before Start is empty.
+type Range struct {
+	Start     int64
+	End       int64
+	Inclusive bool
+}
+
+// NewRange returns the range start..end, or start..<end unless inclusive, both bounds must be integers
+func NewRange(start, end Object, inclusive bool) (*Range, *Error) {
+	from, ok := start.(*Integer)
+	to, ok2 := end.(*Integer)
+	if !ok || !ok2 {
+		return nil, newError(diagnostic.TypeMismatch, "range bounds must be INTEGER, got %s and %s", start.Type(), end.Type())
+	}
+	return &Range{Start: from.Value, End: to.Value, Inclusive: inclusive}, nil
+}
+
+// Implements the Object interface
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+
+// Implements the Object interface
+func (r *Range) Inspect() string {
+	if r.Inclusive {
+		return fmt.Sprintf("%d..%d", r.Start, r.End)
+	}
+	return fmt.Sprintf("%d..<%d", r.Start, r.End)
+}
+
+// Implements Iterable
+func (r *Range) Iterator() Iterator {
+	end := r.End
+	if !r.Inclusive {
+		if end == math.MinInt64 {
+			return &rangeIterator{done: true}
+		}
+		end--
+	}
+	return &rangeIterator{next: r.Start, last: end, done: r.Start > end}
+}
+
+// rangeIterator yields next up to and including last, done avoids overflowing past math.MaxInt64
+type rangeIterator struct {
+	next  int64
+	last  int64
+	index int64
+	done  bool
+}
+
+// Implements the Object interface
+func (it *rangeIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *rangeIterator) Inspect() string  { return "iterator" }
+
+// Implements Iterator
+func (it *rangeIterator) Next() (Object, Object, bool) {
+	if it.done {
+		return nil, nil, false
+	}
+	key, value := &Integer{Value: it.index}, &Integer{Value: it.next}
+	it.done = it.next == it.last
+	it.next++
+	it.index++
+	return key, value, true
+}
+
+// Implements Iterable, the iterator sees the updates of the array made by the loop, e.g. arr[i + 1] = 0
+func (a *Array) Iterator() Iterator {
+	return &arrayIterator{array: a}
+}
+
+type arrayIterator struct {
+	array *Array
+	index int
+}
+
+// Implements the Object interface
+func (it *arrayIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *arrayIterator) Inspect() string  { return "iterator" }
+
+// Implements Iterator
+func (it *arrayIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.array.Elements) {
+		return nil, nil, false
+	}
+	key, value := &Integer{Value: int64(it.index)}, it.array.Elements[it.index]
+	it.index++
+	return key, value, true
+}
+
+// Implements Iterable, the elements are the chars of the string, the keys their indexes as for s[i]
+func (s *String) Iterator() Iterator {
+	return &stringIterator{chars: []rune(s.Value)}
+}
+
+type stringIterator struct {
+	chars []rune
+	index int
+}
+
+// Implements the Object interface
+func (it *stringIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *stringIterator) Inspect() string  { return "iterator" }
+
+// Implements Iterator
+func (it *stringIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.chars) {
+		return nil, nil, false
+	}
+	key, value := &Integer{Value: int64(it.index)}, &String{Value: string(it.chars[it.index])}
+	it.index++
+	return key, value, true
+}
+
+// Implements Iterable, for (k, v in h) binds the keys and the values, for (v in h) only the values.
+// A hash has no insertion order, the keys are iterated in sorted order: grouped by type, numbers by value,
+// others by their Inspect string. The keys are taken when the loop starts, the values when they are reached.
+func (h *Hashes) Iterator() Iterator {
+	keys := make([]HashKey, 0, len(h.Pairs))
+	for key := range h.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keyLess(h.Pairs[keys[i]].Key, h.Pairs[keys[j]].Key)
+	})
+	return &hashIterator{hash: h, keys: keys}
+}
+
+// keyLess orders hash keys for iteration
+func keyLess(a, b Object) bool {
+	kindA, kindB := a.Type(), b.Type()
+	if kindA == BIGINT_OBJ {
+		kindA = INTEGER_OBJ // integers are ordered by value, whether they are big or not
+	}
+	if kindB == BIGINT_OBJ {
+		kindB = INTEGER_OBJ
+	}
+	if kindA != kindB {
+		return kindA < kindB
+	}
+
+	switch kindA {
+	case INTEGER_OBJ:
+		return CompareIntegers(a, b) < 0
+	case FLOAT_OBJ:
+		return a.(*Float).Value < b.(*Float).Value
+	case DECIMAL_OBJ:
+		return CompareDecimals(a, b) < 0
+	default:
+		return a.Inspect() < b.Inspect()
+	}
+}
+
+type hashIterator struct {
+	hash  *Hashes
+	keys  []HashKey
+	index int
+}
+
+// Implements the Object interface
+func (it *hashIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *hashIterator) Inspect() string  { return "iterator" }
+
+// Implements Iterator
+func (it *hashIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.keys) {
+		return nil, nil, false
+	}
+	pair := it.hash.Pairs[it.keys[it.index]]
+	it.index++
+	return pair.Key, pair.Value, true
+}
@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/seblkma/go-himeji/ast"
+	"github.com/seblkma/go-himeji/diagnostic"
+	"github.com/seblkma/go-himeji/opcodes"
 )
 
 type ObjectType string
@@ -14,14 +19,23 @@ type ObjectType string
 const (
 	NULL_OBJ         = "NULL"
 	INTEGER_OBJ      = "INTEGER"
+	BIGINT_OBJ       = "BIGINT"
+	FLOAT_OBJ        = "FLOAT"
+	DECIMAL_OBJ      = "DECIMAL"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	LOOP_CONTROL_OBJ = "LOOP_CONTROL"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	RANGE_OBJ        = "RANGE"
+	ITERATOR_OBJ     = "ITERATOR"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
 )
 
 // The Object interface represents the internal representation of a value, e.g. integer, boolean, etc.
@@ -65,6 +79,32 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// A wrapper for 64-bit floating-point numbers
+type Float struct {
+	Value float64
+}
+
+// Implements the Object interface
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Implements the Object interface, a whole float is written with a fraction, e.g. 2.0, so that it does not look like an integer
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") { // not 1.5, 1e+21, +Inf or NaN
+		s += ".0"
+	}
+	return s
+}
+
+// Implements Hashable, a whole float has the key of the equal integer, since 1 == 1.0
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		whole, _ := big.NewFloat(f.Value).Int(nil) // -0 and 0 are both the integer 0
+		return integerHashKey(whole)
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 // A wrapper for boolean with bool value
 type Boolean struct {
 	Value bool
@@ -98,8 +138,26 @@ func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 // Implements the Object interface
 func (rv *ReturnValue) Inspect() string { return rv.Value.Inspect() }
 
+// LoopControl is the result of a break or continue in the evaluator, like ReturnValue it ends the enclosing blocks up to the loop
+type LoopControl struct {
+	Break bool // otherwise it is a continue
+}
+
+// Implements the Object interface
+func (lc *LoopControl) Type() ObjectType { return LOOP_CONTROL_OBJ }
+
+// Implements the Object interface
+func (lc *LoopControl) Inspect() string {
+	if lc.Break {
+		return "break"
+	}
+	return "continue"
+}
+
 type Error struct {
 	Message string
+	Code    string          // the diagnostic code, e.g. diagnostic.TypeMismatch
+	Span    diagnostic.Span // where the error occurred, set by the evaluator
 }
 
 // Implements Object interface
@@ -107,6 +165,11 @@ func (e *Error) Type() ObjectType { return ERROR_OBJ }
 
 func (e *Error) Inspect() string { return "ERROR: " + e.Message }
 
+// Diagnostic describes the error for rendering with its source
+func (e *Error) Diagnostic() *diagnostic.Diagnostic {
+	return diagnostic.New(e.Code, e.Span, "%s", e.Message)
+}
+
 // The Environment keeps track of objects bindings
 type Environment struct {
 	store map[string]Object
@@ -150,6 +213,18 @@ func (e *Environment) Set(name string, obj Object) Object {
 	return obj
 }
 
+// Assign updates the binding of name in the Environment defining it, which may be an outer one,
+// e.g. a closure updating a counter of the function creating it. It reports false if name is not bound.
+func (e *Environment) Assign(name string, obj Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, found := env.store[name]; found {
+			env.store[name] = obj
+			return true
+		}
+	}
+	return false
+}
+
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
@@ -218,11 +293,15 @@ func (a *Array) Type() ObjectType { return ARRAY_OBJ }
 
 // Implements the Object interface
 func (a *Array) Inspect() string {
+	return inspect(a, map[Object]bool{})
+}
+
+func (a *Array) inspect(visiting map[Object]bool) string {
 	var out bytes.Buffer
 
 	elements := []string{}
 	for _, e := range a.Elements {
-		elements = append(elements, e.Inspect())
+		elements = append(elements, inspect(e, visiting))
 	}
 
 	out.WriteString("[")
@@ -246,12 +325,16 @@ func (h *Hashes) Type() ObjectType { return HASH_OBJ }
 
 // Implements the Object interface
 func (h *Hashes) Inspect() string {
+	return inspect(h, map[Object]bool{})
+}
+
+func (h *Hashes) inspect(visiting map[Object]bool) string {
 	var out bytes.Buffer
 
 	// We want to output the key value pair object associated to the key
 	pairs := []string{}
 	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), inspect(pair.Value, visiting)))
 	}
 
 	out.WriteString("[")
@@ -260,3 +343,81 @@ func (h *Hashes) Inspect() string {
 
 	return out.String()
 }
+
+// inspect writes obj like Inspect. An array or a hash can contain itself, e.g. after let a = [1]; a[0] = a,
+// visiting holds the ones being written, which are written as [...] when reached again.
+func inspect(obj Object, visiting map[Object]bool) string {
+	nested, ok := obj.(interface{ inspect(map[Object]bool) string })
+	if !ok {
+		return obj.Inspect()
+	}
+
+	if visiting[obj] {
+		return "[...]"
+	}
+	visiting[obj] = true
+	defer delete(visiting, obj)
+	return nested.inspect(visiting)
+}
+
+// SetIndex stores value at index of an Array, or under the key index of a Hashes, e.g. for arr[i] = v.
+// The evaluator and the VM both use it, so an index assignment behaves the same in both engines.
+//
+// Arrays and hashes are updated in place and are shared, not copied, by let, assignments, arguments and
+// elements, e.g. after let b = a; b[0] = 1 a[0] is 1 too. Builtins like push still return a new array.
+// An array index must be within the array, an assignment never grows it. It returns nil on success.
+func SetIndex(collection, index, value Object) *Error {
+	switch collection := collection.(type) {
+	case *Array:
+		idx, ok := index.(*Integer)
+		if !ok {
+			if index.Type() != BIGINT_OBJ {
+				return newError(diagnostic.IndexNotSupported, "array index must be INTEGER, got %s", index.Type())
+			}
+		} else if idx.Value >= 0 && idx.Value < int64(len(collection.Elements)) {
+			collection.Elements[idx.Value] = value
+			return nil
+		}
+		return newError(diagnostic.IndexOutOfRange, "index out of range: %s, array length %d", index.Inspect(), len(collection.Elements))
+
+	case *Hashes:
+		key, ok := index.(Hashable)
+		if !ok {
+			return newError(diagnostic.UnusableAsHashKey, "unusable as hash key: %s", index.Type())
+		}
+		collection.Pairs[key.HashKey()] = HashPair{Key: index, Value: value}
+		return nil
+
+	default:
+		return newError(diagnostic.IndexNotSupported, "index assignment not supported: %s", collection.Type())
+	}
+}
+
+// CompiledFunction is a function literal compiled to bytecode, it is passed to the VM as a constant
+type CompiledFunction struct {
+	Instructions  opcodes.Instructions
+	NumLocals     int // no. of local bindings, the VM reserves that many stack slots
+	NumParameters int
+}
+
+// Implements the Object interface
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+
+// Implements the Object interface
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is what the VM calls, a compiled function together with the free variables it captured
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+// Implements the Object interface
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+
+// Implements the Object interface
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
@@ -1,6 +1,9 @@
 package object
 
 import (
+	"fmt"
+	"math"
+	"math/big"
 	"testing"
 )
 
@@ -24,3 +27,326 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+// GOFLAGS="-count=1" go test -run TestFloatInspect
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{2, "2.0"},
+		{-0.5, "-0.5"},
+		{1e21, "1e+21"},
+		{1.5e-7, "1.5e-07"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect of %g. want=%q, got=%q", tt.value, tt.expected, f.Inspect())
+		}
+	}
+
+	if (&Float{Value: 0}).HashKey() != (&Float{Value: math.Copysign(0, -1)}).HashKey() {
+		t.Errorf("0.0 and -0.0 have different hash keys")
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestRegisterBuiltin
+func TestRegisterBuiltin(t *testing.T) {
+	saved := Builtins
+	defer func() { Builtins = saved }()
+
+	count := len(Builtins)
+	lenIndex := -1
+	for i, def := range Builtins {
+		if def.Name == "len" {
+			lenIndex = i
+		}
+	}
+
+	answer := func(args ...Object) Object { return &Integer{Value: 42} }
+
+	index, err := RegisterBuiltin("answer", answer)
+	if err != nil {
+		t.Fatalf("RegisterBuiltin failed: %s", err)
+	}
+	if index != count {
+		t.Errorf("new builtin has wrong index. got=%d, want=%d", index, count)
+	}
+	if GetBuiltinByName("answer") == nil {
+		t.Fatalf("new builtin not found by name")
+	}
+
+	// Replacing keeps the index, compiled code keeps working
+	index, err = RegisterBuiltin("len", answer)
+	if err != nil {
+		t.Fatalf("RegisterBuiltin failed: %s", err)
+	}
+	if index != lenIndex {
+		t.Errorf("replaced builtin has wrong index. got=%d, want=%d", index, lenIndex)
+	}
+	if len(Builtins) != count+1 {
+		t.Errorf("wrong number of builtins. got=%d, want=%d", len(Builtins), count+1)
+	}
+
+	result := GetBuiltinByName("len").Fn()
+	if i, ok := result.(*Integer); !ok || i.Value != 42 {
+		t.Errorf("replaced builtin not called. got=%+v", result)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestRegisterBuiltinLimit
+func TestRegisterBuiltinLimit(t *testing.T) {
+	saved := Builtins
+	defer func() { Builtins = saved }()
+
+	answer := func(args ...Object) Object { return &Integer{Value: 42} }
+
+	for i := len(Builtins); i < MaxBuiltins; i++ {
+		if _, err := RegisterBuiltin(fmt.Sprintf("answer%d", i), answer); err != nil {
+			t.Fatalf("builtin %d not registered: %s", i, err)
+		}
+	}
+
+	_, err := RegisterBuiltin("one_too_many", answer)
+	if err == nil {
+		t.Fatalf("expected an error past %d builtins", MaxBuiltins)
+	}
+	if GetBuiltinByName("one_too_many") != nil {
+		t.Errorf("builtin registered past the limit")
+	}
+
+	// Replacing still works when full
+	if _, err := RegisterBuiltin("len", answer); err != nil {
+		t.Errorf("replacing a builtin failed: %s", err)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestBigIntHashKey
+func TestBigIntHashKey(t *testing.T) {
+	huge1 := AddIntegers(&Integer{Value: math.MaxInt64}, &Integer{Value: 1})
+	huge2 := MulIntegers(&Integer{Value: math.MaxInt64/2 + 1}, &Integer{Value: 2})
+	negated := NegateInteger(huge1)
+
+	if huge1.Type() != BIGINT_OBJ || huge2.Type() != BIGINT_OBJ {
+		t.Fatalf("overflow did not promote to BigInt. got=%s, %s", huge1.Type(), huge2.Type())
+	}
+
+	if huge1.(Hashable).HashKey() != huge2.(Hashable).HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+
+	if huge1.(Hashable).HashKey() == negated.(Hashable).HashKey() {
+		t.Errorf("big integers with different signs have same hash keys")
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestIntegerOverflow
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		result   Object
+		expected string
+	}{
+		{AddIntegers(&Integer{Value: math.MaxInt64}, &Integer{Value: 1}), "BIGINT 9223372036854775808"},
+		{SubIntegers(&Integer{Value: math.MinInt64}, &Integer{Value: 1}), "BIGINT -9223372036854775809"},
+		{MulIntegers(&Integer{Value: math.MinInt64}, &Integer{Value: -1}), "BIGINT 9223372036854775808"},
+		{MulIntegers(&Integer{Value: -1 << 32}, &Integer{Value: 1 << 31}), "INTEGER -9223372036854775808"},
+		{MulIntegers(&Integer{Value: 1 << 32}, &Integer{Value: 1 << 31}), "BIGINT 9223372036854775808"},
+		{NegateInteger(&Integer{Value: math.MinInt64}), "BIGINT 9223372036854775808"},
+		{SubIntegers(AddIntegers(&Integer{Value: math.MaxInt64}, &Integer{Value: 1}), &Integer{Value: 1}), "INTEGER 9223372036854775807"},
+		{AddIntegers(&Integer{Value: -3}, &Integer{Value: 5}), "INTEGER 2"},
+	}
+
+	for _, tt := range tests {
+		got := string(tt.result.Type()) + " " + tt.result.Inspect()
+		if got != tt.expected {
+			t.Errorf("wrong result. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestIntegerLimits
+func TestIntegerLimits(t *testing.T) {
+	tests := []struct {
+		op       func(a, b Object) (Object, error)
+		a, b     int64
+		expected string // the error
+	}{
+		{ShiftLeft, 1, MaxIntegerBits, "integer too large, 1 << 1048576 has more than 1048576 bits"},
+		{ShiftLeft, 1, MaxIntegerBits + 1, "shift count 1048577 too large, at most 1048576"},
+		{ShiftRight, 1, -1, "negative shift count"},
+		{PowIntegers, 3, 1 << 21, "integer too large, 3 ** 2097152 has more than 1048576 bits"},
+		{ModIntegers, 1, 0, "division by zero"},
+	}
+
+	for _, tt := range tests {
+		_, err := tt.op(&Integer{Value: tt.a}, &Integer{Value: tt.b})
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%d, %d: wrong error. want=%q, got=%v", tt.a, tt.b, tt.expected, err)
+		}
+	}
+
+	// 1 ** n and -1 ** n never grow
+	result, err := PowIntegers(&Integer{Value: -1}, &Integer{Value: math.MaxInt64})
+	if err != nil || result.Inspect() != "-1" {
+		t.Errorf("wrong result of -1 ** MaxInt64. got=%v, %v", result, err)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestDecimalInspect
+func TestDecimalInspect(t *testing.T) {
+	tests := []struct {
+		unscaled int64
+		scale    int
+		expected string
+	}{
+		{1250, 2, "12.50"},
+		{-1250, 2, "-12.50"},
+		{5, 3, "0.005"},
+		{-5, 1, "-0.5"},
+		{7, 0, "7"},
+		{0, 2, "0.00"},
+	}
+
+	for _, tt := range tests {
+		d := &Decimal{Unscaled: big.NewInt(tt.unscaled), Scale: tt.scale}
+		if d.Inspect() != tt.expected {
+			t.Errorf("wrong inspect. want=%q, got=%q", tt.expected, d.Inspect())
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestDecimalHashKey
+func TestDecimalHashKey(t *testing.T) {
+	onePointFive := &Decimal{Unscaled: big.NewInt(15), Scale: 1}
+	same := &Decimal{Unscaled: big.NewInt(1500), Scale: 3}
+	fifteen := &Decimal{Unscaled: big.NewInt(15), Scale: 0}
+
+	if onePointFive.HashKey() != same.HashKey() {
+		t.Errorf("1.5 and 1.500 have different hash keys")
+	}
+	if onePointFive.HashKey() == fifteen.HashKey() {
+		t.Errorf("1.5 and 15 have same hash keys")
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestNumberHashKey
+func TestNumberHashKey(t *testing.T) {
+	one := (&Integer{Value: 1}).HashKey()
+	huge := AddIntegers(&Integer{Value: math.MaxInt64}, &Integer{Value: 1}).(Hashable).HashKey()
+
+	tests := []struct {
+		key      Hashable
+		expected HashKey
+	}{
+		{&Float{Value: 1}, one},
+		{&Decimal{Unscaled: big.NewInt(1), Scale: 0}, one},
+		{&Decimal{Unscaled: big.NewInt(100), Scale: 2}, one},
+		{&Float{Value: 1 << 63}, huge},
+		{&Decimal{Unscaled: new(big.Int).Lsh(big.NewInt(10), 63), Scale: 1}, huge},
+	}
+
+	for _, tt := range tests {
+		if tt.key.HashKey() != tt.expected {
+			t.Errorf("%s has a different hash key than the equal integer", tt.key.(Object).Inspect())
+		}
+	}
+
+	if (&Float{Value: 1.5}).HashKey() == (&Decimal{Unscaled: big.NewInt(15), Scale: 1}).HashKey() {
+		t.Errorf("1.5 and 1.5d have same hash keys")
+	}
+	if (&Float{Value: math.Inf(1)}).HashKey().Type != FLOAT_OBJ {
+		t.Errorf("+Inf has an integer hash key")
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestRoundDecimal
+func TestRoundDecimal(t *testing.T) {
+	// Each mode rounds 2.5, -2.5, 2.51, -2.49 and 3.5 to 0 places
+	inputs := []int64{250, -250, 251, -249, 350}
+	tests := []struct {
+		mode     RoundingMode
+		expected []string
+	}{
+		{RoundHalfEven, []string{"2", "-2", "3", "-2", "4"}},
+		{RoundHalfUp, []string{"3", "-3", "3", "-2", "4"}},
+		{RoundHalfDown, []string{"2", "-2", "3", "-2", "3"}},
+		{RoundUp, []string{"3", "-3", "3", "-3", "4"}},
+		{RoundDown, []string{"2", "-2", "2", "-2", "3"}},
+		{RoundCeiling, []string{"3", "-2", "3", "-2", "4"}},
+		{RoundFloor, []string{"2", "-3", "2", "-3", "3"}},
+	}
+
+	for _, tt := range tests {
+		for i, unscaled := range inputs {
+			d := &Decimal{Unscaled: big.NewInt(unscaled), Scale: 2}
+			got := RoundDecimal(d, 0, tt.mode).Inspect()
+			if got != tt.expected[i] {
+				t.Errorf("mode %d: wrong rounding of %s. want=%s, got=%s", tt.mode, d.Inspect(), tt.expected[i], got)
+			}
+		}
+	}
+
+	if got := RoundDecimal(&Decimal{Unscaled: big.NewInt(1250), Scale: 0}, -2, RoundHalfUp).Inspect(); got != "1300" {
+		t.Errorf("wrong rounding to -2 places. want=1300, got=%s", got)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestDivDecimals
+func TestDivDecimals(t *testing.T) {
+	tests := []struct {
+		lhs, rhs Object
+		expected string
+	}{
+		{&Decimal{Unscaled: big.NewInt(1000), Scale: 2}, &Integer{Value: 4}, "2.50"},
+		{&Decimal{Unscaled: big.NewInt(1), Scale: 0}, &Integer{Value: 4}, "0.25"},
+		{&Decimal{Unscaled: big.NewInt(1), Scale: 0}, &Integer{Value: 3}, "0.3333333333333333333333333333"},
+		{&Decimal{Unscaled: big.NewInt(2), Scale: 0}, &Integer{Value: 3}, "0.6666666666666666666666666667"},
+		{&Decimal{Unscaled: big.NewInt(100), Scale: 0}, &Integer{Value: 3}, "33.33333333333333333333333333"},
+		{&Decimal{Unscaled: big.NewInt(-1), Scale: 0}, &Integer{Value: 8}, "-0.125"},
+		{&Decimal{Unscaled: big.NewInt(0), Scale: 1}, &Integer{Value: 3}, "0.0"},
+	}
+
+	for _, tt := range tests {
+		result, err := DivDecimals(tt.lhs, tt.rhs)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("wrong quotient of %s / %s. want=%s, got=%s", tt.lhs.Inspect(), tt.rhs.Inspect(), tt.expected, result.Inspect())
+		}
+	}
+
+	if _, err := DivDecimals(&Decimal{Unscaled: big.NewInt(1), Scale: 0}, &Decimal{Unscaled: big.NewInt(0), Scale: 2}); err != ErrDivisionByZero {
+		t.Errorf("wrong error. want=%v, got=%v", ErrDivisionByZero, err)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestInspectCycles
+func TestInspectCycles(t *testing.T) {
+	one := &Integer{Value: 1}
+
+	a := &Array{Elements: []Object{one}}
+	a.Elements = append(a.Elements, a)
+	if got := a.Inspect(); got != "[1, [...]]" {
+		t.Errorf("wrong Inspect. want=%q, got=%q", "[1, [...]]", got)
+	}
+
+	h := &Hashes{Pairs: map[HashKey]HashPair{}}
+	if err := SetIndex(h, one, &Array{Elements: []Object{h}}); err != nil {
+		t.Fatalf("SetIndex error: %s", err.Message)
+	}
+	if got := h.Inspect(); got != "[1: [[...]]]" {
+		t.Errorf("wrong Inspect. want=%q, got=%q", "[1: [[...]]]", got)
+	}
+
+	// An array shared without a cycle is written in full every time
+	shared := &Array{Elements: []Object{one}}
+	b := &Array{Elements: []Object{shared, shared}}
+	if got := b.Inspect(); got != "[[1], [1]]" {
+		t.Errorf("wrong Inspect. want=%q, got=%q", "[[1], [1]]", got)
+	}
+}
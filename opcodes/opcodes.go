@@ -16,9 +16,19 @@ func (ins Instructions) String() string {
 		def, err := Lookup(ins[i])
 		if err != nil {
 			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
 			continue
 		}
 
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			fmt.Fprintf(&out, "ERROR: operands of %s truncated\n", def.Name)
+			break
+		}
+
 		operands, read := ReadOperands(def, ins[i+1:])
 		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
 
@@ -39,6 +49,8 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		return def.Name
 	case 1:
 		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
 	}
 
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
@@ -46,9 +58,59 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 
 type Opcode byte
 
+// Version identifies the opcode set, it is written to bytecode files.
+// Bump it whenever opcodes are added or their meaning changes.
+const Version = 8
+
 const (
 	OpConstant Opcode = iota
 	OpAdd
+	OpPop
+	OpSub
+	OpMul
+	OpDiv
+	OpTrue
+	OpFalse
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpMinus
+	OpBang
+	OpJumpNotTruthy
+	OpJump
+	OpNull
+	OpGetGlobal
+	OpSetGlobal
+	OpArray
+	OpHash
+	OpIndex
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpGetLocal
+	OpSetLocal
+	OpClosure
+	OpGetFree
+	OpGetBuiltin
+	OpString
+	OpMod
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpGreaterThanOrEqual
+	OpSetFree
+	OpCaptureLocal
+	OpCaptureFree
+	OpSetIndex
+	OpIndexKeep
+	OpRange
+	OpIterator
+	OpIterNext
+	OpLessThan
+	OpLessThanOrEqual
 )
 
 type Definition struct {
@@ -59,6 +121,89 @@ type Definition struct {
 var definitions = map[Opcode]*Definition{
 	OpConstant: {Name: "OpConstant", OperandWidths: []int{2}},
 	OpAdd:      {Name: "OpAdd", OperandWidths: []int{}}, // empty slice, no operand
+	OpPop:      {Name: "OpPop", OperandWidths: []int{}},
+	OpSub:      {Name: "OpSub", OperandWidths: []int{}},
+	OpMul:      {Name: "OpMul", OperandWidths: []int{}},
+	OpDiv:      {Name: "OpDiv", OperandWidths: []int{}},
+	OpTrue:     {Name: "OpTrue", OperandWidths: []int{}},
+	OpFalse:    {Name: "OpFalse", OperandWidths: []int{}},
+
+	OpEqual:       {Name: "OpEqual", OperandWidths: []int{}},
+	OpNotEqual:    {Name: "OpNotEqual", OperandWidths: []int{}},
+	OpGreaterThan: {Name: "OpGreaterThan", OperandWidths: []int{}},
+
+	OpMinus: {Name: "OpMinus", OperandWidths: []int{}},
+	OpBang:  {Name: "OpBang", OperandWidths: []int{}},
+
+	// The single operand is the absolute offset of the instruction to jump to
+	OpJumpNotTruthy: {Name: "OpJumpNotTruthy", OperandWidths: []int{2}},
+	OpJump:          {Name: "OpJump", OperandWidths: []int{2}},
+	OpNull:          {Name: "OpNull", OperandWidths: []int{}},
+
+	// The single operand is the index into the globals store
+	OpGetGlobal: {Name: "OpGetGlobal", OperandWidths: []int{2}},
+	OpSetGlobal: {Name: "OpSetGlobal", OperandWidths: []int{2}},
+
+	// The single operand is the number of stack values to build the array or hash from
+	OpArray: {Name: "OpArray", OperandWidths: []int{2}},
+	OpHash:  {Name: "OpHash", OperandWidths: []int{2}},
+	OpIndex: {Name: "OpIndex", OperandWidths: []int{}},
+
+	// The single operand is the number of arguments sitting on the stack above the function
+	OpCall:        {Name: "OpCall", OperandWidths: []int{1}},
+	OpReturnValue: {Name: "OpReturnValue", OperandWidths: []int{}}, // returns the value on top of the stack
+	OpReturn:      {Name: "OpReturn", OperandWidths: []int{}},      // returns null
+
+	// The single operand is the index of the local binding in the current frame
+	OpGetLocal: {Name: "OpGetLocal", OperandWidths: []int{1}},
+	OpSetLocal: {Name: "OpSetLocal", OperandWidths: []int{1}},
+
+	// The operands are the constant index of the compiled function and the no. of free variables on the stack
+	OpClosure: {Name: "OpClosure", OperandWidths: []int{2, 1}},
+	OpGetFree: {Name: "OpGetFree", OperandWidths: []int{1}},
+
+	// The single operand is the index into object.Builtins
+	OpGetBuiltin: {Name: "OpGetBuiltin", OperandWidths: []int{1}},
+
+	// The single operand is the number of stack values to join into a string, e.g. "a ${x} b"
+	OpString: {Name: "OpString", OperandWidths: []int{2}},
+
+	OpMod:        {Name: "OpMod", OperandWidths: []int{}},
+	OpPow:        {Name: "OpPow", OperandWidths: []int{}},
+	OpBitAnd:     {Name: "OpBitAnd", OperandWidths: []int{}},
+	OpBitOr:      {Name: "OpBitOr", OperandWidths: []int{}},
+	OpBitXor:     {Name: "OpBitXor", OperandWidths: []int{}},
+	OpShiftLeft:  {Name: "OpShiftLeft", OperandWidths: []int{}},
+	OpShiftRight: {Name: "OpShiftRight", OperandWidths: []int{}},
+
+	OpGreaterThanOrEqual: {Name: "OpGreaterThanOrEqual", OperandWidths: []int{}},
+
+	// The single operand is the index of the free variable, an assignment updates the variable it was captured from
+	OpSetFree: {Name: "OpSetFree", OperandWidths: []int{1}},
+
+	// Push a captured variable for OpClosure, so that the closure shares it with the scope defining it.
+	// The single operand is the index of the local binding or of the free variable.
+	OpCaptureLocal: {Name: "OpCaptureLocal", OperandWidths: []int{1}},
+	OpCaptureFree:  {Name: "OpCaptureFree", OperandWidths: []int{1}},
+
+	// Pops the value, the index and the array or hash, and stores the value at the index, e.g. arr[i] = v
+	OpSetIndex: {Name: "OpSetIndex", OperandWidths: []int{}},
+
+	// Like OpIndex but leaves the array or hash and the index on the stack for OpSetIndex, e.g. for arr[i] += v
+	OpIndexKeep: {Name: "OpIndexKeep", OperandWidths: []int{}},
+
+	// Pops the end and the start of a range, the single operand is 1 for start..end and 0 for start..<end
+	OpRange: {Name: "OpRange", OperandWidths: []int{1}},
+
+	// Replaces the iterable on top of the stack with an iterator over it, for a for ... in loop
+	OpIterator: {Name: "OpIterator", OperandWidths: []int{}},
+
+	// Advances the iterator on top of the stack, which stays there. At the end, it jumps to the first operand,
+	// otherwise it pushes the element, or the key and the element if the second operand is 2.
+	OpIterNext: {Name: "OpIterNext", OperandWidths: []int{2, 1}},
+
+	OpLessThan:        {Name: "OpLessThan", OperandWidths: []int{}},
+	OpLessThanOrEqual: {Name: "OpLessThanOrEqual", OperandWidths: []int{}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -86,19 +231,18 @@ func Make(op Opcode, operands ...int) []byte {
 	// First byte of insruction is the opcode
 	instruction := make([]byte, instructionLen)
 	instruction[0] = byte(op)
-	fmt.Printf("instruction: %v\n", instruction)
 	// Make the rest of the instruction
 	offset := 1
 	for i, o := range operands {
 		width := def.OperandWidths[i]
-		fmt.Printf("i:%d, width:%d, offset:%d\n", i, width, offset)
 		switch width {
 		case 2: // operands starts at 2
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
 		}
 		offset += width
 	}
-	fmt.Printf("instruction: %v\n", instruction)
 	return instruction
 }
 
@@ -110,6 +254,8 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 		switch width {
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
 		}
 
 		offset += width
@@ -121,3 +267,7 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
@@ -11,6 +11,8 @@ func TestMake(t *testing.T) {
 	}{
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}}, // fmt.Printf("Byte as hex-> %x,%x\n", byte(255), byte(254)) -> ff,fe
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
 	}
 
 	for _, ti := range testInputs {
@@ -52,6 +54,31 @@ func TestInstructionsString(t *testing.T) {
 	}
 }
 
+// GOFLAGS="-count=1" go test -run TestV3InstructionsString
+func TestV3InstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
+	}
+}
+
 // GOFLAGS="-count=1" go test -run TestV2InstructionsString
 func TestV2InstructionsString(t *testing.T) {
 	instructions := []Instructions{
@@ -75,6 +102,21 @@ func TestV2InstructionsString(t *testing.T) {
 	}
 }
 
+// GOFLAGS="-count=1" go test -run TestMalformedInstructionsString
+func TestMalformedInstructionsString(t *testing.T) {
+	ins := Instructions{byte(OpAdd), 255}
+	ins = append(ins, Make(OpConstant, 1)[:2]...)
+
+	expected := `0000 OpAdd
+ERROR: opcode 255 undefined
+ERROR: operands of OpConstant truncated
+`
+
+	if ins.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, ins.String())
+	}
+}
+
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
 		op        Opcode
@@ -82,6 +124,8 @@ func TestReadOperands(t *testing.T) {
 		bytesRead int
 	}{
 		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
 	}
 
 	for _, tt := range tests {
@@ -1,10 +1,15 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/seblkma/go-himeji/ast"
+	"github.com/seblkma/go-himeji/diagnostic"
 	"github.com/seblkma/go-himeji/lexer"
 	tk "github.com/seblkma/go-himeji/token" // naming conflicts with go/token
 )
@@ -14,11 +19,15 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	LOGICALOR     // ||
+	LOGICALAND    // &&
 	EQUALS        // ==
 	LESSERGREATER // > or <
-	SUM           // +
-	PRODUCT       // *
+	RANGE         // 0..n or 0..<n, the bounds are sums, 0..n - 1 is 0..(n - 1)
+	SUM           // + or the bitwise | and ^
+	PRODUCT       // * or the bitwise &, << and >>
 	PREFIX        // -X or !X
+	POWER         // **, binds tighter than a prefix on its left, -2 ** 2 is -(2 ** 2)
 	CALL          // callFunction(X)
 	INDEX         // array[index]
 )
@@ -26,16 +35,29 @@ const (
 // Precedence table, e.g. multiplication has higher precedence than addition
 // The whole idea of PRATT parser
 var precedences = map[tk.TokenType]int{
-	tk.EQ:       EQUALS,
-	tk.NOT_EQ:   EQUALS,
-	tk.LT:       LESSERGREATER,
-	tk.GT:       LESSERGREATER,
-	tk.PLUS:     SUM,
-	tk.MINUS:    SUM,
-	tk.SLASH:    PRODUCT,
-	tk.ASTERISK: PRODUCT,
-	tk.LPAREN:   CALL,
-	tk.LBRACKET: INDEX,
+	tk.OR:              LOGICALOR,
+	tk.AND:             LOGICALAND,
+	tk.EQ:              EQUALS,
+	tk.NOT_EQ:          EQUALS,
+	tk.LT:              LESSERGREATER,
+	tk.GT:              LESSERGREATER,
+	tk.LT_EQ:           LESSERGREATER,
+	tk.GT_EQ:           LESSERGREATER,
+	tk.PLUS:            SUM,
+	tk.MINUS:           SUM,
+	tk.PIPE:            SUM,
+	tk.CARET:           SUM,
+	tk.SLASH:           PRODUCT,
+	tk.ASTERISK:        PRODUCT,
+	tk.PERCENT:         PRODUCT,
+	tk.AMPERSAND:       PRODUCT,
+	tk.SHL:             PRODUCT,
+	tk.SHR:             PRODUCT,
+	tk.RANGE:           RANGE,
+	tk.RANGE_EXCLUSIVE: RANGE,
+	tk.POWER:           POWER,
+	tk.LPAREN:          CALL,
+	tk.LBRACKET:        INDEX,
 }
 
 // Function types for associating to each specific token type
@@ -50,14 +72,24 @@ type Parser struct {
 	curToken  tk.Token // current token
 	peekToken tk.Token // next token
 
-	errors []string
+	diagnostics []*diagnostic.Diagnostic
+	panicking   bool // an error was reported, the following ones are suppressed until synchronize
+
+	// Nesting of the tokens up to and including curToken, synchronize skips over nested tokens
+	braceDepth int // {}
+	parenDepth int // () and []
+
+	// Where break and continue may appear, see parseLoopControl
+	loopDepth   int  // loops around curToken, within the innermost function
+	valueIfs    int  // if expressions used as a value around curToken, within the innermost loop
+	ifStatement bool // the if expression being parsed is the expression of an expression statement
 
 	prefixParseFns map[tk.TokenType]prefixParseFn
 	infixParseFns  map[tk.TokenType]infixParseFn
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l}
 
 	// Ensures curToken and peekToken are set
 	p.nextToken()
@@ -67,6 +99,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[tk.TokenType]prefixParseFn)
 	p.registerPrefix(tk.IDENT, p.parseIdentifier)
 	p.registerPrefix(tk.INT, p.parseIntegerLiteral)
+	p.registerPrefix(tk.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(tk.DECIMAL, p.parseDecimalLiteral)
 	p.registerPrefix(tk.BANG, p.parsePrefixExpression)
 	p.registerPrefix(tk.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(tk.TRUE, p.parseBoolean)
@@ -75,6 +109,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(tk.IF, p.parseIfExpression)
 	p.registerPrefix(tk.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(tk.STRING, p.parseStringLiteral)
+	p.registerPrefix(tk.STRING_HEAD, p.parseInterpolatedString)
 	p.registerPrefix(tk.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(tk.LBRACE, p.parseHashLiteral)
 
@@ -88,50 +123,187 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(tk.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(tk.LT, p.parseInfixExpression)
 	p.registerInfix(tk.GT, p.parseInfixExpression)
+	p.registerInfix(tk.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(tk.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(tk.PERCENT, p.parseInfixExpression)
+	p.registerInfix(tk.POWER, p.parseInfixExpression)
+	p.registerInfix(tk.AND, p.parseInfixExpression)
+	p.registerInfix(tk.OR, p.parseInfixExpression)
+	p.registerInfix(tk.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(tk.PIPE, p.parseInfixExpression)
+	p.registerInfix(tk.CARET, p.parseInfixExpression)
+	p.registerInfix(tk.SHL, p.parseInfixExpression)
+	p.registerInfix(tk.SHR, p.parseInfixExpression)
+	p.registerInfix(tk.RANGE, p.parseInfixExpression)
+	p.registerInfix(tk.RANGE_EXCLUSIVE, p.parseInfixExpression)
 	p.registerInfix(tk.LPAREN, p.parseCallExpression)
 	p.registerInfix(tk.LBRACKET, p.parseIndexExpression)
 
 	return p
 }
 
+// Errors returns the messages of Diagnostics, each prefixed with the line:column where it occurred
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := []string{}
+	for _, d := range p.Diagnostics() {
+		errors = append(errors, d.Error())
+	}
+	return errors
+}
+
+// Diagnostics returns the problems found by the lexer and the parser, in source order
+func (p *Parser) Diagnostics() []*diagnostic.Diagnostic {
+	diagnostics := append([]*diagnostic.Diagnostic{}, p.l.Diagnostics()...)
+	diagnostics = append(diagnostics, p.diagnostics...)
+	diagnostic.Sort(diagnostics)
+	return diagnostics
+}
+
+// report records d unless the parser is recovering from an earlier error, which has likely caused d
+func (p *Parser) report(d *diagnostic.Diagnostic) *diagnostic.Diagnostic {
+	if !p.panicking {
+		p.diagnostics = append(p.diagnostics, d)
+	}
+	p.panicking = true
+	return d
 }
 
 func (p *Parser) peekError(t tk.TokenType) {
-	msg := fmt.Sprintf("expected next token is %s, but got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	d := p.report(diagnostic.New(diagnostic.UnexpectedToken, diagnostic.TokenSpan(p.peekToken),
+		"expected next token is %s, but got %s instead", t, p.peekToken.Type))
+
+	// Punctuation token types are their own literal, those can be inserted as they are
+	if isPunctuation(t) {
+		d.SetFix(fmt.Sprintf("insert %q", t), diagnostic.At(p.peekToken.Pos, 0), string(t))
+	}
+}
+
+func isPunctuation(t tk.TokenType) bool {
+	for _, ch := range t {
+		if 'A' <= ch && ch <= 'Z' || ch == '_' {
+			return false
+		}
+	}
+	return true
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	switch p.curToken.Type {
+	case tk.LBRACE:
+		p.braceDepth++
+	case tk.RBRACE:
+		p.braceDepth--
+	case tk.LPAREN, tk.LBRACKET:
+		p.parenDepth++
+	case tk.RPAREN, tk.RBRACKET:
+		p.parenDepth--
+	}
 }
 
+// ParseProgram parses the whole input. On errors, the program is partial but well-formed,
+// with BadStatement and BadExpression nodes where the source failed to parse.
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != tk.EOF {
-		stmt := p.parseStatement()
-		//if stmt != nil { parseStatement never returns nil
+		stmt := p.parseStatementRecovering()
 		program.Statements = append(program.Statements, stmt)
-		//}
 		p.nextToken()
 	}
 
+	program.Comments = p.l.Comments()
+
 	return program
 }
 
+// statementKeywords start statements, synchronize stops before them
+var statementKeywords = map[tk.TokenType]bool{
+	tk.LET:      true,
+	tk.RETURN:   true,
+	tk.WHILE:    true,
+	tk.FOR:      true,
+	tk.BREAK:    true,
+	tk.CONTINUE: true,
+}
+
+// parseStatementRecovering parses a statement like parseStatement.
+// On an error, it skips to the end of the statement, the parser can go on with the next one.
+func (p *Parser) parseStatementRecovering() ast.Statement {
+	start := p.curToken
+
+	// The nesting before the statement
+	braceDepth, parenDepth := p.braceDepth, p.parenDepth
+	switch start.Type {
+	case tk.LBRACE:
+		braceDepth--
+	case tk.RBRACE:
+		braceDepth++
+	case tk.LPAREN, tk.LBRACKET:
+		parenDepth--
+	case tk.RPAREN, tk.RBRACKET:
+		parenDepth++
+	}
+
+	stmt := p.parseStatement()
+	if p.panicking {
+		p.synchronize(braceDepth, parenDepth)
+		if stmt == nil {
+			stmt = &ast.BadStatement{Token: start, End: diagnostic.TokenSpan(p.curToken).End}
+		}
+	}
+
+	// The comments of the first and last tokens, e.g. the ";", are those of the statement
+	comments := stmt.Comments()
+	comments.Leading = start.Leading()
+	comments.Trailing = p.curToken.Trailing()
+
+	return stmt
+}
+
+// synchronize skips tokens up to the end of the statement being parsed, at the given nesting.
+// The statement ends with a ";" or before a "}" closing the enclosing block, a statement keyword or EOF.
+// Leaves the last token of the statement in curToken, like the parse functions do.
+func (p *Parser) synchronize(braceDepth, parenDepth int) {
+	for !p.peekTokenIs(tk.EOF) {
+		if p.braceDepth <= braceDepth {
+			if p.curTokenIs(tk.SEMICOLON) && p.parenDepth <= parenDepth {
+				break
+			}
+			if p.peekTokenIs(tk.RBRACE) || statementKeywords[p.peekToken.Type] {
+				break
+			}
+		}
+		p.nextToken()
+	}
+
+	p.panicking = false
+}
+
+// parseStatement returns nil if the statement failed to parse
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case tk.LET:
-		return p.parseLetStatement()
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
 	case tk.RETURN:
 		return p.parseReturnStatement()
+	case tk.WHILE:
+		if stmt := p.parseWhileStatement(); stmt != nil {
+			return stmt
+		}
+	case tk.FOR:
+		return p.parseForStatement()
+	case tk.BREAK, tk.CONTINUE:
+		return p.parseLoopControl()
 	default:
 		return p.parseExpressionStatement() // parses prefix, infix as well
 	}
+	return nil
 }
 
 func (p *Parser) curTokenIs(t tk.TokenType) bool {
@@ -231,12 +403,18 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+// parseExpressionStatement also parses an assignment, which starts like an expression, e.g. x = 1 or x += 1
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	defer untrace(trace("parseExpressionStatement"))
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
+	p.ifStatement = p.curTokenIs(tk.IF)
 	stmt.Expression = p.parseExpression(LOWEST)
 
+	if isAssignment(p.peekToken.Type) {
+		return p.parseAssignStatement(stmt.Expression)
+	}
+
 	// Move to next token if semi-colon, semi-colon is optional in an expression
 	if p.peekTokenIs(tk.SEMICOLON) {
 		p.nextToken()
@@ -245,6 +423,48 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	return stmt
 }
 
+// parseAssignStatement parses the rest of an assignment to target, the assignment operator is the peek token.
+// The target is a variable or an index expression, e.g. x = 1 or h["a"][0] += 1.
+func (p *Parser) parseAssignStatement(target ast.Expression) ast.Statement {
+	p.nextToken()
+	assign := p.curToken
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		if target != nil {
+			p.report(diagnostic.New(diagnostic.InvalidAssignment, diagnostic.TokenSpan(p.curToken), "cannot assign to %s", target)).
+				AddNote("only a variable, an array element or a hash value can be assigned to")
+		}
+		return nil
+	}
+
+	p.nextToken()
+	value := p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(tk.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if index, ok := target.(*ast.IndexExpression); ok {
+		return &ast.IndexAssignStatement{Token: assign, Target: index, Value: value}
+	}
+	return &ast.AssignStatement{Token: assign, Name: target.(*ast.Identifier), Value: value}
+}
+
+// isAssignment reports whether t is = or a compound assignment like +=
+func isAssignment(t tk.TokenType) bool {
+	if t == tk.ASSIGN {
+		return true
+	}
+	for _, assign := range tk.CompoundAssignments {
+		if t == assign {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Parser) parseExpressionList(end tk.TokenType) []ast.Expression {
 	list := []ast.Expression{}
 
@@ -272,25 +492,32 @@ func (p *Parser) parseExpressionList(end tk.TokenType) []ast.Expression {
 // parseExpression parses prefixes by lookup tables - heart of the Pratt parser
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	defer untrace(trace("parseExpression"))
+	start := p.curToken
 	doPrefix := p.prefixParseFns[p.curToken.Type]
 	if doPrefix == nil {
 		//fmt.Printf("Failed to find prefixParseFn for %T\n", p.curToken.Type)
-		p.noParseFnError(p.curToken.Type)
-		return nil
+		p.noParseFnError(p.curToken)
+		return &ast.BadExpression{Token: start}
 	}
 	leftExpr := doPrefix()
+	if leftExpr == nil {
+		return &ast.BadExpression{Token: start}
+	}
 
 	// Attempts to find an infix with higher precedence by advancing the tokens
 	for !p.peekTokenIs(tk.SEMICOLON) && precedence < p.peekPrecedence() {
 		doInfix := p.infixParseFns[p.peekToken.Type]
 		if doInfix == nil {
-			p.noParseFnError(p.peekToken.Type)
+			p.noParseFnError(p.peekToken)
 			return leftExpr
 		}
 
 		p.nextToken()
 
 		leftExpr = doInfix(leftExpr)
+		if leftExpr == nil {
+			return &ast.BadExpression{Token: start}
+		}
 	}
 
 	return leftExpr
@@ -307,9 +534,14 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return expr
 }
 
-func (p *Parser) noParseFnError(t tk.TokenType) {
-	msg := fmt.Sprintf("no parse function for %s", t)
-	p.errors = append(p.errors, msg)
+func (p *Parser) noParseFnError(t tk.Token) {
+	// The lexer has reported the illegal character already
+	if t.Type == tk.ILLEGAL {
+		return
+	}
+
+	p.report(diagnostic.New(diagnostic.ExpectedExpression, diagnostic.TokenSpan(t), "no parse function for %s", t.Type)).
+		AddNote("an expression cannot start with %s", t.Type)
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
@@ -321,6 +553,10 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
+	if expr.Token.Type == tk.POWER {
+		// Right-associative, 2 ** 3 ** 2 is 2 ** (3 ** 2), the rhs takes in the following ** too
+		precedence--
+	}
 	p.nextToken()                              // moves to next token, to parse the rhs expression
 	expr.Right = p.parseExpression(precedence) // recursive call to parseExpression, get back the rhs identifier
 
@@ -335,11 +571,26 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	defer untrace(trace("parseIntegerLiteral"))
 	lit := &ast.IntegerLiteral{Token: p.curToken}
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	literal := p.curToken.Literal
+	if problem, note := checkIntegerLiteral(literal); problem != "" {
+		d := p.report(diagnostic.New(diagnostic.InvalidInteger, diagnostic.TokenSpan(p.curToken), "%s", problem))
+		if note != "" {
+			d.AddNote("%s", note)
+		}
+		return &ast.BadExpression{Token: p.curToken}
+	}
+
+	value, err := strconv.ParseInt(literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		// Beyond int64, the literal is a BigInt like the results of integer arithmetic overflowing
+		if exact, ok := new(big.Int).SetString(literal, 0); ok {
+			lit.Big = exact
+			return lit
+		}
+	}
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+		p.report(diagnostic.New(diagnostic.InvalidInteger, diagnostic.TokenSpan(p.curToken), "could not parse %q as integer", literal))
+		return &ast.BadExpression{Token: p.curToken}
 	}
 
 	lit.Value = value
@@ -348,6 +599,131 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// checkIntegerLiteral returns what is wrong with the integer literal lit, and a note on how to fix it if any,
+// or "" if it is well-formed. lit is decimal, or has a 0x, 0o or 0b prefix, or a leading 0 for octal like in Go, e.g. 0755.
+func checkIntegerLiteral(lit string) (string, string) {
+	base, name, prefix := 10, "decimal", ""
+	if len(lit) > 1 && lit[0] == '0' {
+		switch lit[1] {
+		case 'x', 'X':
+			base, name, prefix = 16, "hexadecimal", lit[:2]
+		case 'o', 'O':
+			base, name, prefix = 8, "octal", lit[:2]
+		case 'b', 'B':
+			base, name, prefix = 2, "binary", lit[:2]
+		default:
+			base, name, prefix = 8, "octal", lit[:1]
+		}
+	}
+
+	digits := lit[len(prefix):]
+	if strings.Trim(digits, "_") == "" && prefix != "0" {
+		return fmt.Sprintf("no digits in %s literal %s", name, lit), ""
+	}
+	for _, ch := range digits {
+		if ch != '_' && digitValue(ch) >= base {
+			return fmt.Sprintf("invalid digit %q in %s literal %s", ch, name, lit), ""
+		}
+	}
+	if !separatorsBetweenDigits(lit, len(prefix), func(ch byte) bool { return digitValue(rune(ch)) < base }) {
+		return fmt.Sprintf("misplaced _ in %s literal %s", name, lit), "_ must be between two digits, e.g. 1_000_000 or 0xFF_FF"
+	}
+	return "", ""
+}
+
+// separatorsBetweenDigits reports whether every _ of the number literal lit follows a digit, or the prefix
+// which is the first prefixLen bytes of lit, and precedes a digit, e.g. 1_000 and 0x_FF but not 1__000 or 1_
+func separatorsBetweenDigits(lit string, prefixLen int, isDigit func(byte) bool) bool {
+	for i := prefixLen; i < len(lit); i++ {
+		if lit[i] != '_' {
+			continue
+		}
+		if i > prefixLen && !isDigit(lit[i-1]) || i+1 == len(lit) || !isDigit(lit[i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// digitValue returns the value of the digit ch in bases up to 16, or 16 if ch is not such a digit
+func digitValue(ch rune) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch - 'a' + 10)
+	case 'A' <= ch && ch <= 'F':
+		return int(ch - 'A' + 10)
+	default:
+		return 16
+	}
+}
+
+// isDecimalDigit is the isDigit of separatorsBetweenDigits for floats and decimals
+func isDecimalDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	defer untrace(trace("parseFloatLiteral"))
+	lit := &ast.FloatLiteral{Token: p.curToken}
+	if !separatorsBetweenDigits(p.curToken.Literal, 0, isDecimalDigit) {
+		p.report(diagnostic.New(diagnostic.InvalidFloat, diagnostic.TokenSpan(p.curToken), "misplaced _ in float literal %s", p.curToken.Literal)).
+			AddNote("_ must be between two digits, e.g. 1_000.5")
+		return &ast.BadExpression{Token: p.curToken}
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(p.curToken.Literal, "_", ""), 64)
+	if err != nil {
+		p.report(diagnostic.New(diagnostic.InvalidFloat, diagnostic.TokenSpan(p.curToken), "could not parse %q as float", p.curToken.Literal)).
+			AddNote("floats are 64-bit, up to %g", math.MaxFloat64)
+		return &ast.BadExpression{Token: p.curToken}
+	}
+
+	lit.Value = value
+
+	// Do not move to next token.
+	return lit
+}
+
+// maxDecimalExponent bounds the exponent of a decimal literal, 1e1000000000d would not fit in memory
+const maxDecimalExponent = 10000
+
+func (p *Parser) parseDecimalLiteral() ast.Expression {
+	defer untrace(trace("parseDecimalLiteral"))
+	lit := &ast.DecimalLiteral{Token: p.curToken}
+	if !separatorsBetweenDigits(p.curToken.Literal, 0, isDecimalDigit) {
+		p.report(diagnostic.New(diagnostic.InvalidDecimal, diagnostic.TokenSpan(p.curToken), "misplaced _ in decimal literal %s", p.curToken.Literal)).
+			AddNote("_ must be between two digits, e.g. 1_000.50d")
+		return &ast.BadExpression{Token: p.curToken}
+	}
+
+	// The lexer guarantees digits[.digits][e[+-]digits]d, with _ between digits
+	literal := strings.ReplaceAll(p.curToken.Literal, "_", "")
+	mantissa, exponent, _ := strings.Cut(strings.ToLower(strings.TrimSuffix(literal, "d")), "e")
+	whole, fraction, _ := strings.Cut(mantissa, ".")
+	exp := 0
+	if exponent != "" {
+		var err error
+		exp, err = strconv.Atoi(exponent)
+		if err != nil || exp < -maxDecimalExponent || exp > maxDecimalExponent {
+			p.report(diagnostic.New(diagnostic.InvalidDecimal, diagnostic.TokenSpan(p.curToken), "could not parse %q as decimal", p.curToken.Literal)).
+				AddNote("the exponent of a decimal is at most %d", maxDecimalExponent)
+			return &ast.BadExpression{Token: p.curToken}
+		}
+	}
+
+	lit.Unscaled, _ = new(big.Int).SetString(whole+fraction, 10)
+	lit.Scale = len(fraction) - exp
+	if lit.Scale < 0 {
+		// 1.5e3d is 1500, with no digits after the decimal point
+		lit.Unscaled.Mul(lit.Unscaled, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-lit.Scale)), nil))
+		lit.Scale = 0
+	}
+
+	// Do not move to next token.
+	return lit
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	defer untrace(trace("parseBoolean"))
 	b := &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(tk.TRUE)}
@@ -377,12 +753,18 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.curTokenIs(tk.RBRACE) && !p.curTokenIs(tk.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			blk.Statements = append(blk.Statements, stmt)
-		}
+		stmt := p.parseStatementRecovering()
+		blk.Statements = append(blk.Statements, stmt)
 		p.nextToken()
 	}
+	blk.EndComments = p.curToken.Leading()
+
+	if p.curTokenIs(tk.EOF) {
+		p.report(diagnostic.New(diagnostic.UnexpectedToken, diagnostic.TokenSpan(p.curToken),
+			"expected next token is }, but got EOF instead")).
+			SetFix(`insert "}"`, diagnostic.At(p.curToken.Pos, 0), "}").
+			AddNote("the block starting at %s is not closed", blk.Token.Pos)
+	}
 
 	return blk
 }
@@ -392,6 +774,14 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
 	expr := &ast.IfExpression{Token: p.curToken}
 
+	// A break in an if used as a value, e.g. 1 + if (c) { break }, would leave the values before the if on the VM stack
+	statement := p.ifStatement
+	p.ifStatement = false
+	if !statement {
+		p.valueIfs++
+		defer func() { p.valueIfs-- }()
+	}
+
 	// If after parsing and next token is not LPAREN, then this is not what we expect
 	if !p.moveNextIfPeekTokenIs(tk.LPAREN) {
 		return nil
@@ -426,6 +816,173 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expr
 }
 
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	defer untrace(trace("parseWhileStatement"))
+
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.moveNextIfPeekTokenIs(tk.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.moveNextIfPeekTokenIs(tk.RPAREN) {
+		return nil
+	}
+
+	if !p.moveNextIfPeekTokenIs(tk.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(tk.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseForStatement parses for (init; condition; post) { body }, where init, condition and post may be left out,
+// or for (x in c) { body } and for (k, x in c) { body }
+func (p *Parser) parseForStatement() ast.Statement {
+	defer untrace(trace("parseForStatement"))
+
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.moveNextIfPeekTokenIs(tk.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	if p.curTokenIs(tk.IDENT) && (p.peekTokenIs(tk.IN) || p.peekTokenIs(tk.COMMA)) {
+		if forIn := p.parseForInStatement(stmt.Token); forIn != nil {
+			return forIn
+		}
+		return nil
+	}
+
+	// The init statement is a let, an assignment or an expression, which takes its ";" if there is one
+	if !p.curTokenIs(tk.SEMICOLON) {
+		if p.curTokenIs(tk.LET) {
+			if let := p.parseLetStatement(); let != nil {
+				stmt.Init = let
+			}
+		} else {
+			stmt.Init = p.parseExpressionStatement()
+		}
+		if stmt.Init == nil || !p.curTokenIs(tk.SEMICOLON) && !p.moveNextIfPeekTokenIs(tk.SEMICOLON) {
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(tk.SEMICOLON) {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.moveNextIfPeekTokenIs(tk.SEMICOLON) {
+		return nil
+	}
+
+	if !p.peekTokenIs(tk.RPAREN) {
+		p.nextToken()
+		stmt.Post = p.parseExpressionStatement()
+		if stmt.Post == nil {
+			return nil
+		}
+	}
+	if !p.moveNextIfPeekTokenIs(tk.RPAREN) {
+		return nil
+	}
+
+	if !p.moveNextIfPeekTokenIs(tk.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(tk.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseForInStatement parses the rest of for (x in c) { body } or for (k, x in c) { body }, curToken is the first name
+func (p *Parser) parseForInStatement(forToken tk.Token) *ast.ForInStatement {
+	stmt := &ast.ForInStatement{Token: forToken}
+
+	stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekTokenIs(tk.COMMA) {
+		p.nextToken()
+		if !p.moveNextIfPeekTokenIs(tk.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.moveNextIfPeekTokenIs(tk.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.moveNextIfPeekTokenIs(tk.RPAREN) {
+		return nil
+	}
+
+	if !p.moveNextIfPeekTokenIs(tk.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(tk.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseLoopBody parses the block of a loop, where break and continue may appear
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	loopDepth, valueIfs := p.loopDepth, p.valueIfs
+	p.loopDepth, p.valueIfs = loopDepth+1, 0
+	body := p.parseBlockStatement()
+	p.loopDepth, p.valueIfs = loopDepth, valueIfs
+
+	return body
+}
+
+// parseLoopControl parses break or continue. They must be in a loop of the same function,
+// and not in an if expression used as a value within that loop.
+func (p *Parser) parseLoopControl() ast.Statement {
+	tok := p.curToken
+
+	switch {
+	case p.loopDepth == 0:
+		p.report(diagnostic.New(diagnostic.MisplacedBreak, diagnostic.TokenSpan(tok), "%s outside a loop", tok.Literal))
+		return nil
+	case p.valueIfs > 0:
+		p.report(diagnostic.New(diagnostic.MisplacedBreak, diagnostic.TokenSpan(tok), "%s in an if expression used as a value", tok.Literal)).
+			AddNote("only an if statement of the loop body may %s the loop", tok.Literal)
+		return nil
+	}
+
+	if p.peekTokenIs(tk.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if tok.Type == tk.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 
@@ -466,7 +1023,11 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// break and continue do not reach out of a function
+	loopDepth, valueIfs := p.loopDepth, p.valueIfs
+	p.loopDepth, p.valueIfs = 0, 0
 	fnl.Body = p.parseBlockStatement()
+	p.loopDepth, p.valueIfs = loopDepth, valueIfs
 
 	return fnl
 }
@@ -500,6 +1061,9 @@ func (p *Parser) parseCallExpression(callFunction ast.Expression) ast.Expression
 	expr := &ast.CallExpression{Token: p.curToken, Function: callFunction}
 	//expr.Arguments = p.parseCallArguments()
 	expr.Arguments = p.parseExpressionList(tk.RPAREN) // same as parseCallArguments but accepts the ending token
+	if expr.Arguments == nil {
+		return nil
+	}
 	return expr
 }
 
@@ -511,9 +1075,45 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return lit
 }
 
+// parseInterpolatedString parses the tokens of "a ${x} b", STRING_HEAD, the expression x and STRING_TAIL.
+// A STRING_MIDDLE goes on with the next ${...}.
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	defer untrace(trace("parseInterpolatedString"))
+	str := &ast.InterpolatedString{Token: p.curToken}
+	str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+
+	for !p.curTokenIs(tk.STRING_TAIL) {
+		if p.peekTokenIs(tk.STRING_MIDDLE) || p.peekTokenIs(tk.STRING_TAIL) {
+			open := diagnostic.TokenSpan(p.curToken).End
+			open.Offset -= 2 // the ${ ending the token
+			open.Column -= 2
+			span := diagnostic.Span{Start: open, End: diagnostic.At(p.peekToken.Pos, 1).End}
+			p.report(diagnostic.New(diagnostic.ExpectedExpression, span, "empty interpolation")).
+				AddNote(`write \${ for a "$" followed by "{"`)
+			return nil
+		}
+		p.nextToken()
+		str.Parts = append(str.Parts, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(tk.STRING_MIDDLE) && !p.peekTokenIs(tk.STRING_TAIL) {
+			p.report(diagnostic.New(diagnostic.UnexpectedToken, diagnostic.TokenSpan(p.peekToken),
+				"expected } closing the interpolation, but got %s instead", p.peekToken.Type)).
+				SetFix(`insert "}"`, diagnostic.At(p.peekToken.Pos, 0), "}")
+			return nil
+		}
+		p.nextToken()
+		str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	return str
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(tk.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
 	return array
 }
 
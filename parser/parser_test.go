@@ -2,14 +2,17 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/seblkma/go-himeji/ast"
+	"github.com/seblkma/go-himeji/diagnostic"
 	"github.com/seblkma/go-himeji/lexer"
+	tk "github.com/seblkma/go-himeji/token"
 )
 
 func checkParserErrors(t *testing.T, p *Parser) {
-	errors := p.errors
+	errors := p.Errors()
 	if len(errors) == 0 {
 		//fmt.Println("no error")
 		return
@@ -419,6 +422,17 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5", 5, "<", 5},
 		{"5 == 5", 5, "==", 5},
 		{"5 != 5", 5, "!=", 5},
+		{"5 <= 5", 5, "<=", 5},
+		{"5 >= 5", 5, ">=", 5},
+		{"5 % 5", 5, "%", 5},
+		{"5 ** 5", 5, "**", 5},
+		{"5 & 5", 5, "&", 5},
+		{"5 | 5", 5, "|", 5},
+		{"5 ^ 5", 5, "^", 5},
+		{"5 << 5", 5, "<<", 5},
+		{"5 >> 5", 5, ">>", 5},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
@@ -494,6 +508,21 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"a + add(b * c) + d", "((a + add((b * c))) + d)"},
 		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))", "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))"},
 		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
+		// the complete operator set
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a == b && c != d", "((a == b) && (c != d))"},
+		{"a <= b == c >= d", "((a <= b) == (c >= d))"},
+		{"a + b % c", "(a + (b % c))"},
+		{"a | b ^ c & d", "((a | b) ^ (c & d))"},
+		{"a << b + c", "((a << b) + c)"},
+		{"a & b == c", "((a & b) == c)"},
+		{"a ** b ** c", "(a ** (b ** c))"},
+		{"a * b ** c", "(a * (b ** c))"},
+		{"a ** b * c", "((a ** b) * c)"},
+		{"-a ** b", "(-(a ** b))"},
+		{"a ** -b", "(a ** (-b))"},
+		{"!a && b", "((!a) && b)"},
 		// array index expressions
 		{
 			"a * [1, 2, 3, 4][b * c] * d",
@@ -909,7 +938,7 @@ func TestHashLiterals(t *testing.T) {
 		if !ok {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
 		}
-		expectedValue := expected[keyLiteral.String()]
+		expectedValue := expected[keyLiteral.Value]
 		testIntegerLiteral(t, value, expectedValue)
 	}
 }
@@ -985,12 +1014,656 @@ func TestParseHashLiteralsExpressions(t *testing.T) {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
 		}
 
-		testFn, found := testFns[keyLiteral.String()]
+		testFn, found := testFns[keyLiteral.Value]
 		if !found {
-			t.Errorf("No test function for key %q found", keyLiteral.String())
+			t.Errorf("No test function for key %q found", keyLiteral.Value)
 			continue
 		}
 
 		testFn(value)
 	}
 }
+
+// GOFLAGS="-count=1" go test -run TestParserErrorPositions
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x 5;", []string{"1:7: expected next token is =, but got INT instead"}},
+		{"1 + 2;\n  let = 10;", []string{"2:7: expected next token is IDENT, but got = instead"}},
+		{"if (x) {\n\tx\n} else 5", []string{"3:8: expected next token is {, but got INT instead"}},
+		{"\n  0b102;", []string{`2:3: invalid digit '2' in binary literal 0b102`}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Fatalf("input %q: wrong number of errors. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+		for i, want := range tt.expected {
+			if errors[i] != want {
+				t.Errorf("input %q: wrong error. want=%q, got=%q", tt.input, want, errors[i])
+			}
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestNodePositions
+func TestNodePositions(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a + b\n};\nadd(1, [2][0]);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	body := let.Value.(*ast.FunctionLiteral).Body
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "1:1"},
+		{let, "1:1"},
+		{let.Name, "1:5"},
+		{let.Value, "1:11"},
+		{body, "1:20"},
+		{body.Statements[0], "2:3"},
+		{call, "4:1"},
+		{call.Arguments[0], "4:5"},
+		{call.Arguments[1], "4:8"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expected {
+			t.Errorf("tests[%d] - position of %q wrong. want=%s, got=%s", i, tt.node.String(), tt.expected, tt.node.Pos())
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestParserDiagnostics
+func TestParserDiagnostics(t *testing.T) {
+	input := "let x 5;\n1 @ 2;"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("wrong number of diagnostics. want=2, got=%d (%q)", len(diagnostics), p.Errors())
+	}
+
+	unexpected := diagnostics[0]
+	if unexpected.Code != diagnostic.UnexpectedToken {
+		t.Errorf("wrong code. want=%s, got=%s", diagnostic.UnexpectedToken, unexpected.Code)
+	}
+	if unexpected.Span.Start.Column != 7 || unexpected.Span.End.Column != 8 {
+		t.Errorf("wrong span. got=%+v", unexpected.Span)
+	}
+	if unexpected.Fix == nil || unexpected.Fix.Replacement != "=" || unexpected.Fix.Span.Start != unexpected.Span.Start {
+		t.Errorf("wrong fix. got=%+v", unexpected.Fix)
+	}
+
+	// Reported by the lexer only, not again as an expression that cannot start with ILLEGAL
+	illegal := diagnostics[1]
+	if illegal.Code != diagnostic.IllegalCharacter || illegal.Error() != "2:3: illegal character '@'" {
+		t.Errorf("wrong diagnostic. got=%s %q", illegal.Code, illegal.Error())
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestParserRecovery
+func TestParserRecovery(t *testing.T) {
+	tests := []struct {
+		input      string
+		errors     []string
+		statements []string
+	}{
+		{
+			"let x = add(1, 2;\nlet y = 3;",
+			[]string{"1:17: expected next token is ), but got ; instead"},
+			[]string{"let x = <bad expression>;", "let y = 3;"},
+		},
+		{
+			"let = 1; let y 2; let z = 3;",
+			[]string{
+				"1:5: expected next token is IDENT, but got = instead",
+				"1:16: expected next token is =, but got INT instead",
+			},
+			[]string{"<bad statement>", "<bad statement>", "let z = 3;"},
+		},
+		{
+			"if (x) { let = (1 + [2, 3]); y }; z",
+			[]string{"1:14: expected next token is IDENT, but got = instead"},
+			[]string{"ifx  <bad statement>y", "z"},
+		},
+		{
+			"fn(x) { x + 1",
+			[]string{"1:14: expected next token is }, but got EOF instead"},
+			[]string{"fn(x)(x + 1)"},
+		},
+		{
+			"0b102 + 1; 2",
+			[]string{`1:1: invalid digit '2' in binary literal 0b102`},
+			[]string{"(<bad expression> + 1)", "2"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.errors) {
+			t.Fatalf("input %q: wrong number of errors. want=%q, got=%q", tt.input, tt.errors, errors)
+		}
+		for i, want := range tt.errors {
+			if errors[i] != want {
+				t.Errorf("input %q: wrong error. want=%q, got=%q", tt.input, want, errors[i])
+			}
+		}
+
+		if len(program.Statements) != len(tt.statements) {
+			t.Fatalf("input %q: wrong number of statements. want=%q, got=%q", tt.input, tt.statements, program.String())
+		}
+		for i, want := range tt.statements {
+			if program.Statements[i].String() != want {
+				t.Errorf("input %q: wrong statement. want=%q, got=%q", tt.input, want, program.Statements[i].String())
+			}
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestStatementComments
+func TestStatementComments(t *testing.T) {
+	input := `// doubles x
+let double = fn(x) {
+	x * 2 # the result
+	// nothing else
+};
+double(2); /* four */
+// the end`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 2, len(program.Statements))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	body := let.Value.(*ast.FunctionLiteral).Body
+
+	tests := []struct {
+		comments []tk.Comment
+		expected []string
+	}{
+		{let.Comments().Leading, []string{"// doubles x"}},
+		{let.Comments().Trailing, nil},
+		{body.Statements[0].Comments().Trailing, []string{"# the result"}},
+		{body.EndComments, []string{"// nothing else"}},
+		{program.Statements[1].Comments().Leading, nil},
+		{program.Statements[1].Comments().Trailing, []string{"/* four */"}},
+		{program.Comments, []string{"// doubles x", "# the result", "// nothing else", "/* four */", "// the end"}},
+	}
+
+	for i, tt := range tests {
+		if len(tt.comments) != len(tt.expected) {
+			t.Fatalf("tests[%d] - wrong number of comments. want=%q, got=%+v", i, tt.expected, tt.comments)
+		}
+		for j, c := range tt.comments {
+			if c.Text != tt.expected[j] {
+				t.Errorf("tests[%d] - wrong comment. want=%q, got=%q", i, tt.expected[j], c.Text)
+			}
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestStringLiteralRoundTrip
+func TestStringLiteralRoundTrip(t *testing.T) {
+	inputs := []string{
+		`"tab\there \"quoted\" back\\slash"`,
+		"`raw \\n`",
+		"\"\"\"\nline 1\nline 2\"\"\"",
+	}
+
+	for _, input := range inputs {
+		program := New(lexer.New(input)).ParseProgram()
+		lit := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral)
+
+		// Printing and parsing again must give the same value
+		reparsed := New(lexer.New(lit.String())).ParseProgram()
+		again := reparsed.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral)
+		if again.Value != lit.Value {
+			t.Errorf("input %s printed as %s changed. want=%q, got=%q", input, lit.String(), lit.Value, again.Value)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestInterpolatedString
+func TestInterpolatedString(t *testing.T) {
+	input := `"hello ${name}, you have ${len(items)} items"`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+	}
+
+	expected := []string{`"hello "`, "name", `", you have "`, "len(items)", `" items"`}
+	if len(str.Parts) != len(expected) {
+		t.Fatalf("wrong number of parts. want=%d, got=%d", len(expected), len(str.Parts))
+	}
+	for i, part := range str.Parts {
+		if part.String() != expected[i] {
+			t.Errorf("parts[%d] wrong. want=%s, got=%s", i, expected[i], part.String())
+		}
+	}
+
+	if str.String() != input {
+		t.Errorf("wrong string. want=%s, got=%s", input, str.String())
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestInterpolatedStringErrors
+func TestInterpolatedStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a ${} b"; 1`, "1:4: empty interpolation"},
+		{`"a ${x y} b"; 1`, "1:8: expected } closing the interpolation, but got IDENT instead"},
+		{`"a ${x`, "1:7: expected } closing the interpolation, but got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("input %s: wrong errors. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestIntegerLiteralForms
+func TestIntegerLiteralForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF;", 255},
+		{"0Xff_ff;", 65535},
+		{"0o17;", 15},
+		{"0b1010;", 10},
+		{"0x_1F;", 31},
+		{"1_000_000;", 1000000},
+		{"0755;", 493},
+		{"0x7FFF_FFFF_FFFF_FFFF;", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected || literal.Big != nil {
+			t.Errorf("literal.Value not %d. got=%d, Big=%v", tt.expected, literal.Value, literal.Big)
+		}
+		if literal.String() != tt.input[:len(tt.input)-1] {
+			t.Errorf("literal.String() not %q. got=%q", tt.input, literal.String())
+		}
+	}
+
+	// Beyond int64 a literal is a BigInt
+	bigTests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775808", "9223372036854775808"},
+		{"0xFFFF_FFFF_FFFF_FFFF", "18446744073709551615"},
+		{"0b1" + strings.Repeat("0", 64), "18446744073709551616"},
+		{"123456789012345678901234567890", "123456789012345678901234567890"},
+	}
+
+	for _, tt := range bigTests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Big == nil || literal.Big.String() != tt.expected {
+			t.Errorf("input %q: literal.Big not %s. got=%v", tt.input, tt.expected, literal.Big)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestNumberLiteralErrors
+func TestNumberLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedCode  string
+		expectedError string
+		expectedNotes []string
+	}{
+		{"0b102", diagnostic.InvalidInteger, "1:1: invalid digit '2' in binary literal 0b102", nil},
+		{"0o8", diagnostic.InvalidInteger, "1:1: invalid digit '8' in octal literal 0o8", nil},
+		{"0xG", diagnostic.InvalidInteger, "1:1: invalid digit 'G' in hexadecimal literal 0xG", nil},
+		{"089", diagnostic.InvalidInteger, "1:1: invalid digit '8' in octal literal 089", nil},
+		{"0x", diagnostic.InvalidInteger, "1:1: no digits in hexadecimal literal 0x", nil},
+		{
+			"1__000",
+			diagnostic.InvalidInteger,
+			"1:1: misplaced _ in decimal literal 1__000",
+			[]string{"_ must be between two digits, e.g. 1_000_000 or 0xFF_FF"},
+		},
+		{"1_", diagnostic.InvalidInteger, "1:1: misplaced _ in decimal literal 1_", []string{"_ must be between two digits, e.g. 1_000_000 or 0xFF_FF"}},
+		{"1_.5", diagnostic.InvalidFloat, "1:1: misplaced _ in float literal 1_.5", []string{"_ must be between two digits, e.g. 1_000.5"}},
+		{"1.5_e3", diagnostic.InvalidFloat, "1:1: misplaced _ in float literal 1.5_e3", []string{"_ must be between two digits, e.g. 1_000.5"}},
+		{"1_000.50_d", diagnostic.InvalidDecimal, "1:1: misplaced _ in decimal literal 1_000.50_d", []string{"_ must be between two digits, e.g. 1_000.50d"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 {
+			t.Errorf("input %q: no diagnostics", tt.input)
+			continue
+		}
+		d := diagnostics[0]
+		if d.Code != tt.expectedCode || d.Error() != tt.expectedError {
+			t.Errorf("input %q: wrong diagnostic. want=%s %q, got=%s %q", tt.input, tt.expectedCode, tt.expectedError, d.Code, d.Error())
+		}
+		if strings.Join(d.Notes, "\n") != strings.Join(tt.expectedNotes, "\n") {
+			t.Errorf("input %q: wrong notes. want=%q, got=%q", tt.input, tt.expectedNotes, d.Notes)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestFloatLiteralExpression
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5;", 1.5},
+		{"6.02e23;", 6.02e23},
+		{"1E-3;", 0.001},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+		if literal.String() != tt.input[:len(tt.input)-1] {
+			t.Errorf("literal.String() not %q. got=%q", tt.input, literal.String())
+		}
+	}
+
+	p := New(lexer.New("1e999"))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 1 || errors[0] != `1:1: could not parse "1e999" as float` {
+		t.Errorf("wrong errors. got=%q", errors)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestDecimalLiteralExpression
+func TestDecimalLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedUnscaled string
+		expectedScale    int
+	}{
+		{"12.50d;", "1250", 2},
+		{"7d;", "7", 0},
+		{"0.001d;", "1", 3},
+		{"1.5e3d;", "1500", 0},
+		{"2.5E-2d;", "25", 3},
+		{"123456789012345678901234567890.5d;", "1234567890123456789012345678905", 1},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.DecimalLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.DecimalLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Unscaled.String() != tt.expectedUnscaled || literal.Scale != tt.expectedScale {
+			t.Errorf("wrong value. want=%s scale %d, got=%s scale %d", tt.expectedUnscaled, tt.expectedScale, literal.Unscaled, literal.Scale)
+		}
+		if literal.String() != tt.input[:len(tt.input)-1] {
+			t.Errorf("literal.String() not %q. got=%q", tt.input, literal.String())
+		}
+	}
+
+	p := New(lexer.New("1e99999d"))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 1 || errors[0] != `1:1: could not parse "1e99999d" as decimal` {
+		t.Errorf("wrong errors. got=%q", errors)
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestAssignStatements
+func TestAssignStatements(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedName     string
+		expectedOperator string
+		expectedString   string
+	}{
+		{"x = 5;", "x", "", "x = 5;"},
+		{"x += y * 2", "x", "+", "x += (y * 2);"},
+		{"total **= 2;", "total", "**", "total **= 2;"},
+		{"flags <<= 1 + 1", "flags", "<<", "flags <<= (1 + 1);"},
+		{"x = y = 1", "x", "", ""}, // an assignment is not an expression
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if tt.expectedString == "" {
+			if len(p.Errors()) == 0 {
+				t.Errorf("input %q: no errors", tt.input)
+			}
+			continue
+		}
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("input %q: program has %d statements, want 1", tt.input, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.AssignStatement)
+		if !ok {
+			t.Fatalf("input %q: statement not *ast.AssignStatement. got=%T", tt.input, program.Statements[0])
+		}
+		if stmt.Name.Value != tt.expectedName || stmt.Operator() != tt.expectedOperator {
+			t.Errorf("input %q: wrong assignment. want=%s %q, got=%s %q", tt.input, tt.expectedName, tt.expectedOperator, stmt.Name.Value, stmt.Operator())
+		}
+		if stmt.String() != tt.expectedString {
+			t.Errorf("input %q: stmt.String() wrong. want=%q, got=%q", tt.input, tt.expectedString, stmt.String())
+		}
+	}
+
+	p := New(lexer.New("f() = 1; x = 2"))
+	program := p.ParseProgram()
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 || diagnostics[0].Code != diagnostic.InvalidAssignment || diagnostics[0].Error() != "1:5: cannot assign to f()" {
+		t.Fatalf("wrong diagnostics. got=%v", diagnostics)
+	}
+	// The parser goes on with the next statement
+	if _, ok := program.Statements[1].(*ast.AssignStatement); !ok {
+		t.Errorf("statement not *ast.AssignStatement. got=%T", program.Statements[1])
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestIndexAssignStatements
+func TestIndexAssignStatements(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedOperator string
+		expectedString   string
+	}{
+		{"arr[0] = 5;", "", "(arr[0]) = 5;"},
+		{`h["a"]["b"] = x + 1`, "", `((h["a"])["b"]) = (x + 1);`},
+		{"arr[i - 1] *= 2", "*", "(arr[(i - 1)]) *= 2;"},
+		{"f()[0] = 1", "", "(f()[0]) = 1;"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("input %q: program has %d statements, want 1", tt.input, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.IndexAssignStatement)
+		if !ok {
+			t.Fatalf("input %q: statement not *ast.IndexAssignStatement. got=%T", tt.input, program.Statements[0])
+		}
+		if stmt.Operator() != tt.expectedOperator {
+			t.Errorf("input %q: wrong operator. want=%q, got=%q", tt.input, tt.expectedOperator, stmt.Operator())
+		}
+		if stmt.String() != tt.expectedString {
+			t.Errorf("input %q: stmt.String() wrong. want=%q, got=%q", tt.input, tt.expectedString, stmt.String())
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestLoopStatements
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedString string
+	}{
+		{"while (i < 10) { i += 1 }", "while ((i < 10)) { i += 1; }"},
+		{"while (true) { if (x) { break }; continue; }", "while (true) { ifx  break;continue; }"},
+		{"for (let i = 0; i < 3; i += 1) { print(i) }", "for (let i = 0; (i < 3); i += 1) { print(i) }"},
+		{"for (i = 0; i < 3; i = i + 1) { }", "for (i = 0; (i < 3); i = (i + 1)) {  }"},
+		{"for (;;) { break; }", "for (; ; ) { break; }"},
+		{"for (; x;) { f() }", "for (; x; ) { f() }"},
+		{"let f = fn() { while (true) { return 1 } }", "let f = fn()while (true) { return  = 1; };"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("input %q: program has %d statements, want 1", tt.input, len(program.Statements))
+		}
+		if program.Statements[0].String() != tt.expectedString {
+			t.Errorf("input %q: wrong string. want=%q, got=%q", tt.input, tt.expectedString, program.Statements[0].String())
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestForInStatements
+func TestForInStatements(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedString string
+	}{
+		{"for (x in arr) { print(x) }", "for (x in arr) { print(x) }"},
+		{"for (k, v in h) { k }", "for (k, v in h) { k }"},
+		{"for (i in 0..n - 1) { }", "for (i in (0 .. (n - 1))) {  }"},
+		{"for (i in 0..<len(a)) { break }", "for (i in (0 ..< len(a))) { break; }"},
+		{"let r = 1 + 2..3 * 4", "let r = ((1 + 2) .. (3 * 4));"},
+		{"a..b == c", "((a .. b) == c)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("input %q: program has %d statements, want 1", tt.input, len(program.Statements))
+		}
+		if program.Statements[0].String() != tt.expectedString {
+			t.Errorf("input %q: wrong string. want=%q, got=%q", tt.input, tt.expectedString, program.Statements[0].String())
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestMisplacedBreak
+func TestMisplacedBreak(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break", "1:1: break outside a loop"},
+		{"if (x) { continue }", "1:10: continue outside a loop"},
+		{"while (x) { let f = fn() { break } }", "1:28: break outside a loop"},
+		{"while (x) { let y = 1 + if (z) { break } }", "1:34: break in an if expression used as a value"},
+		{"while (x) { f(if (z) { if (y) { continue } }) }", "1:33: continue in an if expression used as a value"},
+		{"for (x in a) { let f = fn() { continue } }", "1:31: continue outside a loop"},
+		{"for (break; x;) { }", "1:6: no parse function for BREAK"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 || diagnostics[0].Error() != tt.expected {
+			t.Errorf("input %q: wrong diagnostics. want=%q, got=%v", tt.input, tt.expected, diagnostics)
+		}
+	}
+
+	// An if statement of a loop body, or a loop in an if used as a value, may break
+	inputs := []string{
+		"while (x) { if (y) { if (z) { break } } else { continue } }",
+		"let a = if (x) { while (y) { break } }",
+		"for (;;) { if (y) { break } + 1 }",
+	}
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		checkParserErrors(t, p)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/seblkma/go-himeji/replcompiler
 replace (
 	github.com/seblkma/go-himeji/ast => ../ast
 	github.com/seblkma/go-himeji/compiler => ../compiler
+	github.com/seblkma/go-himeji/diagnostic => ../diagnostic
 	github.com/seblkma/go-himeji/evaluator => ../evaluator
 	github.com/seblkma/go-himeji/lexer => ../lexer
 	github.com/seblkma/go-himeji/object => ../object
@@ -16,14 +17,15 @@ go 1.22.5
 
 require (
 	github.com/seblkma/go-himeji/compiler v0.0.0-00010101000000-000000000000
+	github.com/seblkma/go-himeji/diagnostic v0.0.0-00010101000000-000000000000
 	github.com/seblkma/go-himeji/lexer v0.0.0-00010101000000-000000000000
+	github.com/seblkma/go-himeji/object v0.0.0-00010101000000-000000000000
 	github.com/seblkma/go-himeji/parser v0.0.0-00010101000000-000000000000
 	github.com/seblkma/go-himeji/vm v0.0.0-00010101000000-000000000000
 )
 
 require (
 	github.com/seblkma/go-himeji/ast v0.0.0-00010101000000-000000000000 // indirect
-	github.com/seblkma/go-himeji/object v0.0.0-00010101000000-000000000000 // indirect
 	github.com/seblkma/go-himeji/opcodes v0.0.0-00010101000000-000000000000 // indirect
 	github.com/seblkma/go-himeji/token v0.0.0-00010101000000-000000000000 // indirect
 )
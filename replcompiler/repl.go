@@ -2,11 +2,14 @@ package replinterpreter
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 
 	"github.com/seblkma/go-himeji/compiler"
+	"github.com/seblkma/go-himeji/diagnostic"
 	"github.com/seblkma/go-himeji/lexer"
+	"github.com/seblkma/go-himeji/object"
 	"github.com/seblkma/go-himeji/parser"
 	"github.com/seblkma/go-himeji/vm"
 	// naming conflicts with go/token
@@ -14,15 +17,20 @@ import (
 
 const PROMPT = ">>"
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
-	}
+// printDiagnostics prints the diagnostics under the line they were found in
+func printDiagnostics(out io.Writer, line string, diagnostics ...*diagnostic.Diagnostic) {
+	diagnostic.RenderAll(out, "repl", line, diagnostics)
 }
 
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 
+	// Bindings must survive from one line to the next
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
+	compiler.DefineBuiltins(symbolTable)
+
 	for {
 		fmt.Fprintf(out, PROMPT)
 		scanned := scanner.Scan()
@@ -35,27 +43,37 @@ func Start(in io.Reader, out io.Writer) {
 		p := parser.New(l)
 
 		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		if len(p.Diagnostics()) != 0 {
+			printDiagnostics(out, line, p.Diagnostics()...)
 			continue
 		}
 
-		comp := compiler.New()
+		comp := compiler.NewWithState(symbolTable, constants)
 		err := comp.Compile(program)
+		var d *diagnostic.Diagnostic
+		if errors.As(err, &d) {
+			printDiagnostics(out, line, d)
+			continue
+		}
 		if err != nil {
 			fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
 			continue
 		}
 
-		machine := vm.New(comp.ByteCode())
+		code := comp.ByteCode()
+		constants = code.Constants
+
+		machine := vm.NewWithGlobalState(code, globals)
 		err = machine.Run()
 		if err != nil {
 			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
 			continue
 		}
 
-		stackTop := machine.StackTop()
-		io.WriteString(out, stackTop.Inspect())
-		io.WriteString(out, "\n")
+		lastPopped := machine.LastPoppedStackElem()
+		if lastPopped != nil {
+			io.WriteString(out, lastPopped.Inspect())
+			io.WriteString(out, "\n")
+		}
 	}
 }
@@ -2,9 +2,11 @@ module github.com/seblkma/go-himeji/replinterpreter
 
 replace (
 	github.com/seblkma/go-himeji/ast => ../ast
+	github.com/seblkma/go-himeji/diagnostic => ../diagnostic
 	github.com/seblkma/go-himeji/evaluator => ../evaluator
 	github.com/seblkma/go-himeji/lexer => ../lexer
 	github.com/seblkma/go-himeji/object => ../object
+	github.com/seblkma/go-himeji/opcodes => ../opcodes
 	github.com/seblkma/go-himeji/parser => ../parser
 	github.com/seblkma/go-himeji/token => ../token
 )
@@ -12,6 +14,7 @@ replace (
 go 1.22.5
 
 require (
+	github.com/seblkma/go-himeji/diagnostic v0.0.0-00010101000000-000000000000
 	github.com/seblkma/go-himeji/evaluator v0.0.0-00010101000000-000000000000
 	github.com/seblkma/go-himeji/lexer v0.0.0-00010101000000-000000000000
 	github.com/seblkma/go-himeji/object v0.0.0-00010101000000-000000000000
@@ -20,5 +23,6 @@ require (
 
 require (
 	github.com/seblkma/go-himeji/ast v0.0.0-00010101000000-000000000000 // indirect
+	github.com/seblkma/go-himeji/opcodes v0.0.0-00010101000000-000000000000 // indirect
 	github.com/seblkma/go-himeji/token v0.0.0-00010101000000-000000000000 // indirect
 )
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/seblkma/go-himeji/diagnostic"
 	"github.com/seblkma/go-himeji/evaluator"
 	"github.com/seblkma/go-himeji/lexer"
 	"github.com/seblkma/go-himeji/object"
@@ -14,10 +15,9 @@ import (
 
 const PROMPT = ">>"
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
-	}
+// printDiagnostics prints the diagnostics under the line they were found in
+func printDiagnostics(out io.Writer, line string, diagnostics ...*diagnostic.Diagnostic) {
+	diagnostic.RenderAll(out, "repl", line, diagnostics)
 }
 
 func Start(in io.Reader, out io.Writer) {
@@ -36,13 +36,17 @@ func Start(in io.Reader, out io.Writer) {
 		p := parser.New(l)
 
 		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		if len(p.Diagnostics()) != 0 {
+			printDiagnostics(out, line, p.Diagnostics()...)
 			continue
 		}
 
 		// Version 2 - read eval print loop
 		evaluated := evaluator.Eval(program, env)
+		if err, ok := evaluated.(*object.Error); ok {
+			printDiagnostics(out, line, err.Diagnostic())
+			continue
+		}
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
@@ -1,10 +1,68 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // where the token starts in the source
+	Raw     string   // the source text of a STRING, quotes and escape sequences included, Literal is its value
+	Trivia  *Trivia  // the comments around the token, nil if none (a pointer keeps Token comparable)
+}
+
+// Leading returns the comments before the token
+func (t Token) Leading() []Comment {
+	if t.Trivia == nil {
+		return nil
+	}
+	return t.Trivia.Leading
+}
+
+// Trailing returns the comments after the token on its line
+func (t Token) Trailing() []Comment {
+	if t.Trivia == nil {
+		return nil
+	}
+	return t.Trivia.Trailing
+}
+
+// Comment is a line comment, starting with // or #, or a /* */ block comment.
+// Text is the source text of the comment, delimiters included, without the newline ending a line comment.
+type Comment struct {
+	Text string
+	Pos  Position
+}
+
+// IsBlock reports whether c is a /* */ comment
+func (c Comment) IsBlock() bool {
+	return len(c.Text) >= 2 && c.Text[:2] == "/*"
+}
+
+// Trivia are the comments around a token, kept for formatters and documentation generators
+type Trivia struct {
+	Leading  []Comment // on the lines before the token and before it on its line
+	Trailing []Comment // after the token, up to the end of its line
+}
+
+// Position is a location in the source, lines and columns start at 1.
+type Position struct {
+	Offset int `json:"offset"` // byte offset, starting at 0
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// IsValid reports whether the position was set by the lexer
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -12,9 +70,17 @@ const (
 	EOF     = "EOF"
 
 	// Identifiers and literals
-	IDENT  = "IDENT" // add, var1, var2, x, y ...
-	INT    = "INT"   // 1,2,3,4,5,6 ...
-	STRING = "STRING"
+	IDENT   = "IDENT"   // add, var1, var2, x, y ...
+	INT     = "INT"     // 1,2,3,4,5,6 ...
+	FLOAT   = "FLOAT"   // 1.5, 2e10, 6.02e+23 ...
+	DECIMAL = "DECIMAL" // 12.50d, 1d, 2.5e3d ...
+	STRING  = "STRING"
+
+	// Parts of an interpolated string, e.g. "a ${x} b ${y} c" is the tokens
+	// STRING_HEAD "a ", x, STRING_MIDDLE " b ", y, STRING_TAIL " c"
+	STRING_HEAD   = "STRING_HEAD"
+	STRING_MIDDLE = "STRING_MIDDLE"
+	STRING_TAIL   = "STRING_TAIL"
 
 	// Operators
 	ASSIGN   = "="
@@ -23,12 +89,42 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+	POWER    = "**"
 
 	LT     = "<"
 	GT     = ">"
+	LT_EQ  = "<="
+	GT_EQ  = ">="
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR  = "||"
+
+	AMPERSAND = "&"
+	PIPE      = "|"
+	CARET     = "^"
+	SHL       = "<<"
+	SHR       = ">>"
+
+	// Ranges, 0..3 includes 3, 0..<3 does not
+	RANGE           = ".."
+	RANGE_EXCLUSIVE = "..<"
+
+	// Compound assignments, e.g. x += 1 is x = x + 1
+	PLUS_ASSIGN      = "+="
+	MINUS_ASSIGN     = "-="
+	ASTERISK_ASSIGN  = "*="
+	SLASH_ASSIGN     = "/="
+	PERCENT_ASSIGN   = "%="
+	POWER_ASSIGN     = "**="
+	AMPERSAND_ASSIGN = "&="
+	PIPE_ASSIGN      = "|="
+	CARET_ASSIGN     = "^="
+	SHL_ASSIGN       = "<<="
+	SHR_ASSIGN       = ">>="
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -47,20 +143,45 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 
 	// Arrays
 	LBRACKET = "["
 	RBRACKET = "]"
 )
 
+// CompoundAssignments maps the binary operators to their compound assignment, an operator followed by =
+var CompoundAssignments = map[TokenType]TokenType{
+	PLUS:      PLUS_ASSIGN,
+	MINUS:     MINUS_ASSIGN,
+	ASTERISK:  ASTERISK_ASSIGN,
+	SLASH:     SLASH_ASSIGN,
+	PERCENT:   PERCENT_ASSIGN,
+	POWER:     POWER_ASSIGN,
+	AMPERSAND: AMPERSAND_ASSIGN,
+	PIPE:      PIPE_ASSIGN,
+	CARET:     CARET_ASSIGN,
+	SHL:       SHL_ASSIGN,
+	SHR:       SHR_ASSIGN,
+}
+
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
 }
 
 func LookupIdent(ident string) TokenType {
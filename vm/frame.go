@@ -0,0 +1,21 @@
+package vm
+
+import (
+	"github.com/seblkma/go-himeji/object"
+	"github.com/seblkma/go-himeji/opcodes"
+)
+
+// Frame is the call frame, or activation record, of a function being executed
+type Frame struct {
+	cl          *object.Closure
+	insptr      int // instruction pointer within this frame's function
+	basePointer int // stackptr before the call, local bindings are stored from here
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, insptr: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() opcodes.Instructions {
+	return f.cl.Fn.Instructions
+}
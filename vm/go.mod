@@ -5,6 +5,7 @@ go 1.22.5
 replace (
 	github.com/seblkma/go-himeji/ast => ../ast
 	github.com/seblkma/go-himeji/compiler => ../compiler
+	github.com/seblkma/go-himeji/diagnostic => ../diagnostic
 	github.com/seblkma/go-himeji/lexer => ../lexer
 	github.com/seblkma/go-himeji/object => ../object
 	github.com/seblkma/go-himeji/opcodes => ../opcodes
@@ -21,4 +22,7 @@ require (
 	github.com/seblkma/go-himeji/parser v0.0.0-00010101000000-000000000000
 )
 
-require github.com/seblkma/go-himeji/token v0.0.0-00010101000000-000000000000 // indirect
+require (
+	github.com/seblkma/go-himeji/diagnostic v0.0.0-00010101000000-000000000000 // indirect
+	github.com/seblkma/go-himeji/token v0.0.0-00010101000000-000000000000 // indirect
+)
@@ -0,0 +1,317 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/seblkma/go-himeji/compiler"
+	"github.com/seblkma/go-himeji/object"
+	"github.com/seblkma/go-himeji/opcodes"
+)
+
+// decodedInstruction is an instruction of a code unit together with its operands
+type decodedInstruction struct {
+	pos      int
+	op       opcodes.Opcode
+	def      *opcodes.Definition
+	operands []int
+	next     int // position of the following instruction
+}
+
+// codeUnit is either the main program or the body of a compiled function
+type codeUnit struct {
+	name         string
+	instructions []decodedInstruction
+	byPos        map[int]int // instruction position to index in instructions
+	length       int
+	fn           *object.CompiledFunction // nil for the main program
+}
+
+// Verify checks bytecode, e.g. loaded from an untrusted .bin file, before it is run by a VM.
+// It makes sure that every opcode is defined, every operand is inside the instructions,
+// constants, locals, free variables and built-in functions referenced exist,
+// jumps land on instructions and the stack cannot underflow or grow beyond StackSize.
+func Verify(bytecode *compiler.ByteCode) error {
+	units := []*codeUnit{}
+
+	main, err := decodeUnit("main program", bytecode.Instructions, nil)
+	if err != nil {
+		return err
+	}
+	units = append(units, main)
+
+	for i, c := range bytecode.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		if fn.NumParameters > fn.NumLocals {
+			return fmt.Errorf("function constant %d: %d parameters but only %d locals", i, fn.NumParameters, fn.NumLocals)
+		}
+		unit, err := decodeUnit(fmt.Sprintf("function constant %d", i), fn.Instructions, fn)
+		if err != nil {
+			return err
+		}
+		units = append(units, unit)
+	}
+
+	// A function can only read the free variables it was closed over with
+	numFree := map[int]int{}
+	for _, unit := range units {
+		for _, ins := range unit.instructions {
+			if ins.op != opcodes.OpClosure {
+				continue
+			}
+			constIndex, free := ins.operands[0], ins.operands[1]
+			if constIndex >= len(bytecode.Constants) {
+				return unit.errorf(ins, "constant index %d out of range, %d constants", constIndex, len(bytecode.Constants))
+			}
+			if _, ok := bytecode.Constants[constIndex].(*object.CompiledFunction); !ok {
+				return unit.errorf(ins, "constant %d is not a function", constIndex)
+			}
+			if n, found := numFree[constIndex]; found && n != free {
+				return unit.errorf(ins, "function constant %d closed over %d and %d free variables", constIndex, n, free)
+			}
+			numFree[constIndex] = free
+		}
+	}
+
+	for i, unit := range units {
+		free := 0
+		if i > 0 {
+			free = numFree[indexOfConstant(bytecode.Constants, unit.fn)]
+		}
+
+		err := unit.verifyOperands(bytecode.Constants, free)
+		if err != nil {
+			return err
+		}
+
+		err = unit.verifyStack()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func indexOfConstant(constants []object.Object, fn *object.CompiledFunction) int {
+	for i, c := range constants {
+		if c == fn {
+			return i
+		}
+	}
+	return -1
+}
+
+func decodeUnit(name string, ins opcodes.Instructions, fn *object.CompiledFunction) (*codeUnit, error) {
+	unit := &codeUnit{name: name, byPos: map[int]int{}, length: len(ins), fn: fn}
+
+	for i := 0; i < len(ins); {
+		def, err := opcodes.Lookup(ins[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %04d: %s", name, i, err)
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return nil, fmt.Errorf("%s: %04d: operands of %s truncated, need %d bytes, have %d", name, i, def.Name, width, len(ins)-i-1)
+		}
+
+		operands, read := opcodes.ReadOperands(def, ins[i+1:])
+
+		unit.byPos[i] = len(unit.instructions)
+		unit.instructions = append(unit.instructions, decodedInstruction{
+			pos:      i,
+			op:       opcodes.Opcode(ins[i]),
+			def:      def,
+			operands: operands,
+			next:     i + 1 + read,
+		})
+
+		i += 1 + read
+	}
+
+	return unit, nil
+}
+
+func (u *codeUnit) errorf(ins decodedInstruction, format string, a ...interface{}) error {
+	return fmt.Errorf("%s: %04d %s: %s", u.name, ins.pos, ins.def.Name, fmt.Sprintf(format, a...))
+}
+
+func (u *codeUnit) numLocals() int {
+	if u.fn == nil {
+		return 0
+	}
+	return u.fn.NumLocals
+}
+
+func (u *codeUnit) verifyOperands(constants []object.Object, numFree int) error {
+	for _, ins := range u.instructions {
+		switch ins.op {
+		case opcodes.OpConstant:
+			if ins.operands[0] >= len(constants) {
+				return u.errorf(ins, "constant index %d out of range, %d constants", ins.operands[0], len(constants))
+			}
+
+		case opcodes.OpJump, opcodes.OpJumpNotTruthy, opcodes.OpIterNext:
+			target := ins.operands[0]
+			if _, ok := u.byPos[target]; !ok && target != u.length {
+				return u.errorf(ins, "jump target %d is not an instruction", target)
+			}
+			if ins.op == opcodes.OpIterNext && ins.operands[1] != 1 && ins.operands[1] != 2 {
+				return u.errorf(ins, "iterator yields 1 or 2 values, not %d", ins.operands[1])
+			}
+
+		case opcodes.OpRange:
+			if ins.operands[0] > 1 {
+				return u.errorf(ins, "range operand must be 0 or 1, got %d", ins.operands[0])
+			}
+
+		case opcodes.OpGetLocal, opcodes.OpSetLocal, opcodes.OpCaptureLocal:
+			if ins.operands[0] >= u.numLocals() {
+				return u.errorf(ins, "local index %d out of range, %d locals", ins.operands[0], u.numLocals())
+			}
+
+		case opcodes.OpGetFree, opcodes.OpSetFree, opcodes.OpCaptureFree:
+			if ins.operands[0] >= numFree {
+				return u.errorf(ins, "free variable index %d out of range, %d free variables", ins.operands[0], numFree)
+			}
+
+		case opcodes.OpGetBuiltin:
+			if ins.operands[0] >= len(object.Builtins) {
+				return u.errorf(ins, "builtin index %d out of range, %d builtins", ins.operands[0], len(object.Builtins))
+			}
+
+		case opcodes.OpHash:
+			if ins.operands[0]%2 != 0 {
+				return u.errorf(ins, "odd number of hash elements %d", ins.operands[0])
+			}
+
+		case opcodes.OpReturn:
+			if u.fn == nil {
+				return u.errorf(ins, "return outside of a function")
+			}
+		}
+	}
+
+	return nil
+}
+
+// stackEffect returns how many values the instruction pops and pushes
+func stackEffect(ins decodedInstruction) (int, int, error) {
+	switch ins.op {
+	case opcodes.OpConstant, opcodes.OpTrue, opcodes.OpFalse, opcodes.OpNull,
+		opcodes.OpGetGlobal, opcodes.OpGetLocal, opcodes.OpGetFree,
+		opcodes.OpGetBuiltin, opcodes.OpCaptureLocal, opcodes.OpCaptureFree:
+		return 0, 1, nil
+	case opcodes.OpPop, opcodes.OpSetGlobal, opcodes.OpSetLocal, opcodes.OpSetFree, opcodes.OpJumpNotTruthy:
+		return 1, 0, nil
+	case opcodes.OpAdd, opcodes.OpSub, opcodes.OpMul, opcodes.OpDiv, opcodes.OpMod, opcodes.OpPow,
+		opcodes.OpBitAnd, opcodes.OpBitOr, opcodes.OpBitXor, opcodes.OpShiftLeft, opcodes.OpShiftRight,
+		opcodes.OpEqual, opcodes.OpNotEqual, opcodes.OpGreaterThan, opcodes.OpGreaterThanOrEqual,
+		opcodes.OpLessThan, opcodes.OpLessThanOrEqual, opcodes.OpIndex:
+		return 2, 1, nil
+	case opcodes.OpMinus, opcodes.OpBang, opcodes.OpIterator:
+		return 1, 1, nil
+	case opcodes.OpRange:
+		return 2, 1, nil
+	case opcodes.OpIterNext:
+		return 1, ins.operands[1] + 1, nil // the iterator stays, the jump at the end pushes nothing
+	case opcodes.OpSetIndex:
+		return 3, 0, nil
+	case opcodes.OpIndexKeep:
+		return 2, 3, nil // the array or hash and the index are pushed back
+	case opcodes.OpJump, opcodes.OpReturn:
+		return 0, 0, nil
+	case opcodes.OpReturnValue:
+		return 1, 0, nil
+	case opcodes.OpArray, opcodes.OpHash, opcodes.OpString:
+		return ins.operands[0], 1, nil
+	case opcodes.OpCall:
+		return ins.operands[0] + 1, 1, nil // the arguments and the callee
+	case opcodes.OpClosure:
+		return ins.operands[1], 1, nil
+	default:
+		return 0, 0, fmt.Errorf("verifier does not know %s", ins.def.Name)
+	}
+}
+
+// verifyStack follows every path through the code unit, tracking the stack depth before each instruction.
+// All paths reaching an instruction must agree on the depth.
+func (u *codeUnit) verifyStack() error {
+	if len(u.instructions) == 0 {
+		if u.fn != nil {
+			return fmt.Errorf("%s: function has no instructions", u.name)
+		}
+		return nil
+	}
+
+	depths := map[int]int{0: 0}
+	worklist := []int{0}
+	maxDepth := 0
+
+	for len(worklist) > 0 {
+		pos := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+
+		ins := u.instructions[u.byPos[pos]]
+		depth := depths[pos]
+
+		pops, pushes, err := stackEffect(ins)
+		if err != nil {
+			return u.errorf(ins, "%s", err)
+		}
+		if depth < pops {
+			return u.errorf(ins, "stack underflow, needs %d values, has %d", pops, depth)
+		}
+		depth = depth - pops + pushes
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+
+		var successors []int
+		switch ins.op {
+		case opcodes.OpJump:
+			successors = []int{ins.operands[0]}
+		case opcodes.OpJumpNotTruthy, opcodes.OpIterNext:
+			successors = []int{ins.next, ins.operands[0]}
+		case opcodes.OpReturnValue, opcodes.OpReturn:
+			successors = nil
+		default:
+			successors = []int{ins.next}
+		}
+
+		for i, next := range successors {
+			depth := depth
+			if ins.op == opcodes.OpIterNext && i == 1 {
+				depth -= ins.operands[1] // at the end of the iteration only the iterator is left
+			}
+
+			if next == u.length {
+				if u.fn != nil {
+					return u.errorf(ins, "function ends without a return")
+				}
+				continue
+			}
+
+			if seen, found := depths[next]; found {
+				if seen != depth {
+					return u.errorf(ins, "inconsistent stack depth at %04d, %d and %d", next, seen, depth)
+				}
+				continue
+			}
+			depths[next] = depth
+			worklist = append(worklist, next)
+		}
+	}
+
+	if u.numLocals()+maxDepth > StackSize {
+		return fmt.Errorf("%s: needs %d stack slots, at most %d", u.name, u.numLocals()+maxDepth, StackSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/seblkma/go-himeji/compiler"
+	"github.com/seblkma/go-himeji/object"
+	"github.com/seblkma/go-himeji/opcodes"
+)
+
+func concatInstructions(s ...[]byte) opcodes.Instructions {
+	out := opcodes.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func TestVerifyCompiledPrograms(t *testing.T) {
+	inputs := []string{
+		"",
+		"if (true) { 10 } else { 20 }; 3333;",
+		"let a = [1, 2, 3]; let h = {\"a\": a}; h[\"a\"][0]",
+		`let newAdder = fn(a, b) { fn(c) { a + b + c } }; newAdder(1, 2)(8);`,
+		`let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } }; countDown(1);`,
+		`let f = fn() { if (false) { 1 } }; len(push([1], f()))`,
+		`let f = fn(n) { for (let i = 0; i < n; i += 1) { if (i == 2) { break } else { continue } }; n }; f(3)`,
+		`let f = fn(a) { let n = 0; for (i, x in a) { if (x > 1) { break }; n += i }; for (x in 0..<2) { n += x }; n }; f([1, 2])`,
+	}
+
+	for _, input := range inputs {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = Verify(comp.ByteCode())
+		if err != nil {
+			t.Errorf("verifier rejected %q: %s", input, err)
+		}
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	fn := func(numLocals int, ins ...[]byte) *object.CompiledFunction {
+		return &object.CompiledFunction{Instructions: concatInstructions(ins...), NumLocals: numLocals}
+	}
+
+	deep := opcodes.Instructions{}
+	for i := 0; i <= StackSize; i++ {
+		deep = append(deep, opcodes.Make(opcodes.OpNull)...)
+	}
+
+	tests := []struct {
+		name     string
+		bytecode *compiler.ByteCode
+		expected string
+	}{
+		{
+			"unknown opcode",
+			&compiler.ByteCode{Instructions: opcodes.Instructions{255}},
+			"opcode 255 undefined",
+		},
+		{
+			"truncated operands",
+			&compiler.ByteCode{Instructions: opcodes.Make(opcodes.OpConstant, 0)[:2]},
+			"operands of OpConstant truncated",
+		},
+		{
+			"constant out of range",
+			&compiler.ByteCode{Instructions: concatInstructions(
+				opcodes.Make(opcodes.OpConstant, 1),
+				opcodes.Make(opcodes.OpPop),
+			), Constants: []object.Object{&object.Integer{Value: 1}}},
+			"constant index 1 out of range",
+		},
+		{
+			"closure over non-function",
+			&compiler.ByteCode{Instructions: opcodes.Make(opcodes.OpClosure, 0, 0), Constants: []object.Object{&object.Integer{Value: 1}}},
+			"constant 0 is not a function",
+		},
+		{
+			"jump into operands",
+			&compiler.ByteCode{Instructions: concatInstructions(
+				opcodes.Make(opcodes.OpJump, 4),
+				opcodes.Make(opcodes.OpConstant, 0),
+			), Constants: []object.Object{&object.Integer{Value: 1}}},
+			"jump target 4 is not an instruction",
+		},
+		{
+			"jump past the end",
+			&compiler.ByteCode{Instructions: opcodes.Make(opcodes.OpJump, 9)},
+			"jump target 9 is not an instruction",
+		},
+		{
+			"stack underflow",
+			&compiler.ByteCode{Instructions: concatInstructions(
+				opcodes.Make(opcodes.OpTrue),
+				opcodes.Make(opcodes.OpAdd),
+			)},
+			"stack underflow",
+		},
+		{
+			"inconsistent depth",
+			&compiler.ByteCode{Instructions: concatInstructions(
+				opcodes.Make(opcodes.OpTrue),             // 0000
+				opcodes.Make(opcodes.OpJumpNotTruthy, 7), // 0001
+				opcodes.Make(opcodes.OpTrue),             // 0004
+				opcodes.Make(opcodes.OpTrue),             // 0005
+				opcodes.Make(opcodes.OpTrue),             // 0006
+				opcodes.Make(opcodes.OpNull),             // 0007
+			)},
+			"inconsistent stack depth at 0007",
+		},
+		{
+			"unbounded stack",
+			&compiler.ByteCode{Instructions: concatInstructions(
+				opcodes.Make(opcodes.OpTrue),
+				opcodes.Make(opcodes.OpJump, 0),
+			)},
+			"inconsistent stack depth at 0000",
+		},
+		{
+			"iterator values",
+			&compiler.ByteCode{Instructions: concatInstructions(
+				opcodes.Make(opcodes.OpNull),           // 0000
+				opcodes.Make(opcodes.OpIterator),       // 0001
+				opcodes.Make(opcodes.OpIterNext, 9, 3), // 0002
+				opcodes.Make(opcodes.OpJump, 2),        // 0006
+				opcodes.Make(opcodes.OpPop),            // 0009
+			)},
+			"iterator yields 1 or 2 values, not 3",
+		},
+		{
+			"iterator values left on the stack",
+			&compiler.ByteCode{Instructions: concatInstructions(
+				opcodes.Make(opcodes.OpNull),           // 0000
+				opcodes.Make(opcodes.OpIterator),       // 0001
+				opcodes.Make(opcodes.OpIterNext, 9, 1), // 0002
+				opcodes.Make(opcodes.OpJump, 2),        // 0006
+				opcodes.Make(opcodes.OpPop),            // 0009
+			)},
+			"inconsistent stack depth at 0002",
+		},
+		{
+			"too deep stack",
+			&compiler.ByteCode{Instructions: deep},
+			"needs 2049 stack slots, at most 2048",
+		},
+		{
+			"local in main program",
+			&compiler.ByteCode{Instructions: opcodes.Make(opcodes.OpGetLocal, 0)},
+			"local index 0 out of range, 0 locals",
+		},
+		{
+			"local out of range",
+			&compiler.ByteCode{Constants: []object.Object{fn(1,
+				opcodes.Make(opcodes.OpGetLocal, 1),
+				opcodes.Make(opcodes.OpReturnValue),
+			)}},
+			"local index 1 out of range, 1 locals",
+		},
+		{
+			"free variable out of range",
+			&compiler.ByteCode{
+				Instructions: concatInstructions(
+					opcodes.Make(opcodes.OpTrue),
+					opcodes.Make(opcodes.OpClosure, 0, 1),
+					opcodes.Make(opcodes.OpPop),
+				),
+				Constants: []object.Object{fn(0,
+					opcodes.Make(opcodes.OpGetFree, 1),
+					opcodes.Make(opcodes.OpReturnValue),
+				)},
+			},
+			"free variable index 1 out of range, 1 free variables",
+		},
+		{
+			"builtin out of range",
+			&compiler.ByteCode{Instructions: opcodes.Make(opcodes.OpGetBuiltin, 255)},
+			"builtin index 255 out of range",
+		},
+		{
+			"return in main program",
+			&compiler.ByteCode{Instructions: opcodes.Make(opcodes.OpReturn)},
+			"return outside of a function",
+		},
+		{
+			"function without return",
+			&compiler.ByteCode{Constants: []object.Object{fn(0,
+				opcodes.Make(opcodes.OpTrue),
+				opcodes.Make(opcodes.OpPop),
+			)}},
+			"function ends without a return",
+		},
+	}
+
+	for _, tt := range tests {
+		err := Verify(tt.bytecode)
+		if err == nil {
+			t.Errorf("%s: expected verifier error %q, got none", tt.name, tt.expected)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong verifier error. want=%q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestRunUnknownOpcode
+func TestRunUnknownOpcode(t *testing.T) {
+	// Bytecode that skipped Verify, the VM must not run past an opcode it does not know
+	bytecode := &compiler.ByteCode{Instructions: concatInstructions(
+		opcodes.Make(opcodes.OpTrue),
+		opcodes.Instructions{255},
+	)}
+
+	err := New(bytecode).Run()
+	if err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+	if err.Error() != "unknown opcode 255 at 1" {
+		t.Errorf("wrong error. want=%q, got=%q", "unknown opcode 255 at 1", err)
+	}
+}
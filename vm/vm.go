@@ -2,6 +2,8 @@ package vm
 
 import (
 	"fmt"
+	"math"
+	"strings"
 
 	"github.com/seblkma/go-himeji/compiler"
 	"github.com/seblkma/go-himeji/object"
@@ -9,14 +11,41 @@ import (
 )
 
 const StackSize = 2048
+const GlobalsSize = 65536 // the operand of OpSetGlobal and OpGetGlobal is 2 bytes wide
+const MaxFrames = 1024
+
+// Singletons to be referenced by all Boolean and Null objects, the VM pushes these instead of allocating
+var (
+	True  = &object.Boolean{Value: true}
+	False = &object.Boolean{Value: false}
+	Null  = &object.Null{}
+)
 
 type VM struct {
-	constants    []object.Object
-	instructions opcodes.Instructions
+	constants []object.Object
 
 	stack    []object.Object
 	stackptr int // Always point to the next free slot. Top of the stack is stack[sp-1]
 	// Incremented and decremented as the stack grows or shrinks.
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int // Always point to the next free frame. Current frame is frames[framesIndex-1]
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
 }
 
 func (vm *VM) push(o object.Object) error {
@@ -36,15 +65,34 @@ func (vm *VM) pop() object.Object {
 }
 
 func New(bytecode *compiler.ByteCode) *VM {
+	// The main program is executed as if it were the body of a function
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
 	return &VM{
-		instructions: bytecode.Instructions,
-		constants:    bytecode.Constants,
+		constants: bytecode.Constants,
 
 		stack:    make([]object.Object, StackSize),
 		stackptr: 0,
+
+		globals: make([]object.Object, GlobalsSize),
+
+		frames:      frames,
+		framesIndex: 1,
 	}
 }
 
+// NewWithGlobalState creates a VM that keeps the globals of previous runs, e.g. in a REPL.
+func NewWithGlobalState(bytecode *compiler.ByteCode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
 func (vm *VM) StackTop() object.Object {
 	if vm.stackptr == 0 {
 		return nil
@@ -52,11 +100,25 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.stackptr-1]
 }
 
+// LastPoppedStackElem returns the object most recently popped off the stack.
+// Popping only moves stackptr down, so the object is still in the slot above it.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.stackptr]
+}
+
 func (vm *VM) Run() error {
-	// Fetch instructions
-	for insptr := 0; insptr < len(vm.instructions); insptr++ {
+	var insptr int
+	var ins opcodes.Instructions
+	var op opcodes.Opcode
+
+	// Fetch instructions of the current frame
+	for vm.currentFrame().insptr < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().insptr++
+
+		insptr = vm.currentFrame().insptr
+		ins = vm.currentFrame().Instructions()
 		// Decoded each instruction as opcode. Not using opcodes.Lookup for performance reasons.
-		op := opcodes.Opcode(vm.instructions[insptr])
+		op = opcodes.Opcode(ins[insptr])
 
 		// Pay special attention to details when popping objects off the stack.
 		// The popping order must be correct.
@@ -64,25 +126,846 @@ func (vm *VM) Run() error {
 		case opcodes.OpConstant:
 			// Decode the operands, the byte right after the opcode at insptr+1.
 			// Not using opcodes.ReadOperands for performance reasons.
-			constIndex := opcodes.ReadUint16(vm.instructions[insptr+1:])
-			insptr += 2 // increment the correct size - the no. of bytes read to decode operands
+			constIndex := opcodes.ReadUint16(ins[insptr+1:])
+			vm.currentFrame().insptr += 2 // increment the correct size - the no. of bytes read to decode operands
 			// next iteration the loops starts at opcode
 
 			err := vm.push(vm.constants[constIndex])
 			if err != nil {
 				return err
 			}
-		case opcodes.OpAdd:
-			right := vm.pop()
+
+		case opcodes.OpAdd, opcodes.OpSub, opcodes.OpMul, opcodes.OpDiv, opcodes.OpMod, opcodes.OpPow,
+			opcodes.OpBitAnd, opcodes.OpBitOr, opcodes.OpBitXor, opcodes.OpShiftLeft, opcodes.OpShiftRight:
+			err := vm.executeBinaryOperation(op)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpEqual, opcodes.OpNotEqual, opcodes.OpGreaterThan, opcodes.OpGreaterThanOrEqual,
+			opcodes.OpLessThan, opcodes.OpLessThanOrEqual:
+			err := vm.executeComparison(op)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpTrue:
+			err := vm.push(True)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpFalse:
+			err := vm.push(False)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpBang:
+			err := vm.executeBangOperator()
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpMinus:
+			err := vm.executeMinusOperator()
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpPop:
+			vm.pop()
+
+		case opcodes.OpJump:
+			pos := int(opcodes.ReadUint16(ins[insptr+1:]))
+			vm.currentFrame().insptr = pos - 1 // the loop increments insptr, so land right before the target
+
+		case opcodes.OpJumpNotTruthy:
+			pos := int(opcodes.ReadUint16(ins[insptr+1:]))
+			vm.currentFrame().insptr += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().insptr = pos - 1
+			}
+
+		case opcodes.OpNull:
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpSetGlobal:
+			globalIndex := opcodes.ReadUint16(ins[insptr+1:])
+			vm.currentFrame().insptr += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case opcodes.OpGetGlobal:
+			globalIndex := opcodes.ReadUint16(ins[insptr+1:])
+			vm.currentFrame().insptr += 2
+
+			global := vm.globals[globalIndex]
+			if global == nil {
+				return fmt.Errorf("global %d read before it was set", globalIndex)
+			}
+
+			err := vm.push(global)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpArray:
+			numElements := int(opcodes.ReadUint16(ins[insptr+1:]))
+			vm.currentFrame().insptr += 2
+
+			array := vm.buildArray(vm.stackptr-numElements, vm.stackptr)
+			vm.stackptr = vm.stackptr - numElements
+
+			err := vm.push(array)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpString:
+			numParts := int(opcodes.ReadUint16(ins[insptr+1:]))
+			vm.currentFrame().insptr += 2
+
+			str := vm.buildString(vm.stackptr-numParts, vm.stackptr)
+			vm.stackptr = vm.stackptr - numParts
+
+			err := vm.push(str)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpHash:
+			numElements := int(opcodes.ReadUint16(ins[insptr+1:]))
+			vm.currentFrame().insptr += 2
+
+			hash, err := vm.buildHash(vm.stackptr-numElements, vm.stackptr)
+			if err != nil {
+				return err
+			}
+			vm.stackptr = vm.stackptr - numElements
+
+			err = vm.push(hash)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpIndex:
+			index := vm.pop()
 			left := vm.pop()
-			leftValue := left.(*object.Integer).Value
-			rightValue := right.(*object.Integer).Value
 
-			result := leftValue + rightValue
-			vm.push(&object.Integer{Value: result})
+			err := vm.executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpIndexKeep:
+			index := vm.stack[vm.stackptr-1]
+			left := vm.stack[vm.stackptr-2]
+
+			err := vm.executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			collection := vm.pop()
+
+			if err := object.SetIndex(collection, index, value); err != nil {
+				return fmt.Errorf("%s", err.Message)
+			}
+
+		case opcodes.OpRange:
+			inclusive := opcodes.ReadUint8(ins[insptr+1:])
+			vm.currentFrame().insptr += 1
+
+			end := vm.pop()
+			start := vm.pop()
+			r, err := object.NewRange(start, end, inclusive == 1)
+			if err != nil {
+				return fmt.Errorf("%s", err.Message)
+			}
+			if err := vm.push(r); err != nil {
+				return err
+			}
+
+		case opcodes.OpIterator:
+			it, err := object.Iterate(vm.pop())
+			if err != nil {
+				return fmt.Errorf("%s", err.Message)
+			}
+			if err := vm.push(it); err != nil {
+				return err
+			}
+
+		case opcodes.OpIterNext:
+			pos := int(opcodes.ReadUint16(ins[insptr+1:]))
+			numValues := opcodes.ReadUint8(ins[insptr+3:])
+			vm.currentFrame().insptr += 3
+
+			it, ok := vm.stack[vm.stackptr-1].(object.Iterator)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", vm.stack[vm.stackptr-1].Type())
+			}
+			key, value, ok := it.Next()
+			if !ok {
+				vm.currentFrame().insptr = pos - 1
+				break
+			}
+			if numValues == 2 {
+				if err := vm.push(key); err != nil {
+					return err
+				}
+			}
+			if err := vm.push(value); err != nil {
+				return err
+			}
+
+		case opcodes.OpCall:
+			numArgs := opcodes.ReadUint8(ins[insptr+1:])
+			vm.currentFrame().insptr += 1
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpReturnValue:
+			returnValue := vm.pop()
+
+			if vm.framesIndex == 1 {
+				// Like the evaluator, a return in the main program stops it with the popped value as result
+				return nil
+			}
+
+			frame := vm.popFrame()
+			// Drops the locals, arguments and the function itself off the stack
+			vm.stackptr = frame.basePointer - 1
+
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpReturn:
+			frame := vm.popFrame()
+			vm.stackptr = frame.basePointer - 1
+
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpSetLocal:
+			localIndex := opcodes.ReadUint8(ins[insptr+1:])
+			vm.currentFrame().insptr += 1
+
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if c, ok := (*slot).(*cell); ok {
+				c.value = vm.pop() // shared with a closure
+			} else {
+				*slot = vm.pop()
+			}
+
+		case opcodes.OpGetLocal:
+			localIndex := opcodes.ReadUint8(ins[insptr+1:])
+			vm.currentFrame().insptr += 1
+
+			frame := vm.currentFrame()
+			local := vm.stack[frame.basePointer+int(localIndex)]
+			if c, ok := local.(*cell); ok {
+				local = c.value
+			}
+			if local == nil {
+				return fmt.Errorf("local %d read before it was set", localIndex)
+			}
+
+			err := vm.push(local)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpClosure:
+			constIndex := opcodes.ReadUint16(ins[insptr+1:])
+			numFree := opcodes.ReadUint8(ins[insptr+3:])
+			vm.currentFrame().insptr += 3
+
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpGetFree:
+			freeIndex := opcodes.ReadUint8(ins[insptr+1:])
+			vm.currentFrame().insptr += 1
+
+			free := vm.currentFrame().cl.Free[freeIndex]
+			if c, ok := free.(*cell); ok {
+				free = c.value
+			}
+			if free == nil {
+				return fmt.Errorf("free variable %d read before it was set", freeIndex)
+			}
+
+			err := vm.push(free)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpSetFree:
+			freeIndex := opcodes.ReadUint8(ins[insptr+1:])
+			vm.currentFrame().insptr += 1
+
+			free := vm.currentFrame().cl.Free[freeIndex]
+			c, ok := free.(*cell)
+			if !ok {
+				return fmt.Errorf("free variable %d is not assignable", freeIndex)
+			}
+			c.value = vm.pop()
+
+		case opcodes.OpCaptureLocal:
+			localIndex := opcodes.ReadUint8(ins[insptr+1:])
+			vm.currentFrame().insptr += 1
+
+			// The first capture moves the local into a cell, the frame and the closures share it from then on.
+			// The local may not be set yet, e.g. a let-bound function capturing its own variable.
+			slot := &vm.stack[vm.currentFrame().basePointer+int(localIndex)]
+			if _, ok := (*slot).(*cell); !ok {
+				*slot = &cell{value: *slot}
+			}
+
+			err := vm.push(*slot)
+			if err != nil {
+				return err
+			}
+
+		case opcodes.OpCaptureFree:
+			freeIndex := opcodes.ReadUint8(ins[insptr+1:])
+			vm.currentFrame().insptr += 1
+
+			err := vm.push(vm.currentFrame().cl.Free[freeIndex])
+			if err != nil {
+				return err
+			}
 
+		case opcodes.OpGetBuiltin:
+			builtinIndex := opcodes.ReadUint8(ins[insptr+1:])
+			vm.currentFrame().insptr += 1
+
+			if int(builtinIndex) >= len(object.Builtins) {
+				return fmt.Errorf("undefined builtin %d", builtinIndex)
+			}
+
+			err := vm.push(object.Builtins[builtinIndex].Builtin)
+			if err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("unknown opcode %d at %d", op, insptr)
 		}
 	}
 
 	return nil
 }
+
+// executeCall calls the closure or built-in function sitting on the stack below its numArgs arguments.
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.stackptr-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("calling non-function")
+	}
+}
+
+// callBuiltin runs the built-in function right away, no frame is needed.
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.stackptr-numArgs : vm.stackptr]
+
+	result := builtin.Fn(args...)
+	// Drops the arguments and the built-in function itself off the stack
+	vm.stackptr = vm.stackptr - numArgs - 1
+
+	// A builtin reports an error by returning it, it stops the program like the errors of the VM itself
+	if err, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", err.Message)
+	}
+	if result != nil {
+		return vm.push(result)
+	}
+	return vm.push(Null)
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	fn := cl.Fn
+
+	if numArgs != fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", fn.NumParameters, numArgs)
+	}
+
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("frame overflow")
+	}
+
+	// The arguments become the first local bindings of the new frame
+	frame := NewFrame(cl, vm.stackptr-numArgs)
+	if frame.basePointer+fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	vm.pushFrame(frame)
+
+	// Reserves the stack slots ("the hole") for the remaining local bindings.
+	// Clears them, an earlier call may have left a cell there which is still shared with its closures.
+	vm.stackptr = frame.basePointer + fn.NumLocals
+	clear(vm.stack[frame.basePointer+numArgs : vm.stackptr])
+
+	return nil
+}
+
+// cell holds a variable captured by a closure, shared by the closures and the frame or closure it was captured from.
+// It only ever sits in a local slot or in Closure.Free, OpGetLocal and OpGetFree push its value.
+type cell struct {
+	value object.Object
+}
+
+// Implements the Object interface
+func (c *cell) Type() object.ObjectType { return "CELL" }
+
+// Implements the Object interface
+func (c *cell) Inspect() string { return c.value.Inspect() }
+
+// pushClosure wraps the compiled function constant with the numFree free variables on top of the stack.
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.stackptr-numFree+i]
+	}
+	vm.stackptr = vm.stackptr - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+func (vm *VM) executeBinaryOperation(op opcodes.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	switch {
+	case object.IsInteger(left) && object.IsInteger(right):
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case object.HasDecimalOperands(left, right):
+		// At least one operand is a Decimal, the Integer one is converted to Decimal
+		return vm.executeBinaryDecimalOperation(op, left, right)
+	case object.IsNumber(left) && object.IsNumber(right):
+		// At least one operand is a Float, the Integer one is converted to Float
+		return vm.executeBinaryFloatOperation(op, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	default:
+		return typeMismatchError(op, left, right)
+	}
+}
+
+func (vm *VM) executeBinaryStringOperation(op opcodes.Opcode, left, right object.Object) error {
+	if op != opcodes.OpAdd {
+		return unknownOperatorError(op, left, right)
+	}
+
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	return vm.push(&object.String{Value: leftValue + rightValue})
+}
+
+func (vm *VM) executeBinaryIntegerOperation(op opcodes.Opcode, left, right object.Object) error {
+	var result object.Object
+	var err error
+
+	switch op {
+	case opcodes.OpAdd:
+		result = object.AddIntegers(left, right)
+	case opcodes.OpSub:
+		result = object.SubIntegers(left, right)
+	case opcodes.OpMul:
+		result = object.MulIntegers(left, right)
+	case opcodes.OpDiv:
+		result, err = object.DivIntegers(left, right)
+	case opcodes.OpMod:
+		result, err = object.ModIntegers(left, right)
+	case opcodes.OpPow:
+		result, err = object.PowIntegers(left, right)
+	case opcodes.OpBitAnd:
+		result = object.AndIntegers(left, right)
+	case opcodes.OpBitOr:
+		result = object.OrIntegers(left, right)
+	case opcodes.OpBitXor:
+		result = object.XorIntegers(left, right)
+	case opcodes.OpShiftLeft:
+		result, err = object.ShiftLeft(left, right)
+	case opcodes.OpShiftRight:
+		result, err = object.ShiftRight(left, right)
+	default:
+		return unknownOperatorError(op, left, right)
+	}
+	if err != nil {
+		return err
+	}
+
+	return vm.push(result)
+}
+
+func (vm *VM) executeBinaryDecimalOperation(op opcodes.Opcode, left, right object.Object) error {
+	var result object.Object
+	var err error
+
+	switch op {
+	case opcodes.OpAdd:
+		result = object.AddDecimals(left, right)
+	case opcodes.OpSub:
+		result = object.SubDecimals(left, right)
+	case opcodes.OpMul:
+		result = object.MulDecimals(left, right)
+	case opcodes.OpDiv:
+		result, err = object.DivDecimals(left, right)
+	case opcodes.OpMod:
+		result, err = object.ModDecimals(left, right)
+	case opcodes.OpPow:
+		result, err = object.PowDecimals(left, right)
+	default:
+		return unknownOperatorError(op, left, right)
+	}
+	if err != nil {
+		return err
+	}
+
+	return vm.push(result)
+}
+
+func (vm *VM) executeBinaryFloatOperation(op opcodes.Opcode, left, right object.Object) error {
+	leftValue := object.ToFloat(left)
+	rightValue := object.ToFloat(right)
+
+	var result float64
+
+	switch op {
+	case opcodes.OpAdd:
+		result = leftValue + rightValue
+	case opcodes.OpSub:
+		result = leftValue - rightValue
+	case opcodes.OpMul:
+		result = leftValue * rightValue
+	case opcodes.OpDiv:
+		result = leftValue / rightValue
+	case opcodes.OpMod:
+		result = math.Mod(leftValue, rightValue)
+	case opcodes.OpPow:
+		result = math.Pow(leftValue, rightValue)
+	default:
+		return unknownOperatorError(op, left, right)
+	}
+
+	return vm.push(&object.Float{Value: result})
+}
+
+func (vm *VM) executeComparison(op opcodes.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if object.IsInteger(left) && object.IsInteger(right) {
+		return vm.executeIntegerComparison(op, left, right)
+	}
+	if object.HasDecimalOperands(left, right) {
+		return vm.executeDecimalComparison(op, left, right)
+	}
+	if object.IsNumber(left) && object.IsNumber(right) {
+		return vm.executeFloatComparison(op, left, right)
+	}
+	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left, right)
+	}
+
+	// Reaching here means left and right are pointers to the Boolean singleton instance(s)
+	switch op {
+	case opcodes.OpEqual:
+		return vm.push(toBooleanObjectInstance(right == left))
+	case opcodes.OpNotEqual:
+		return vm.push(toBooleanObjectInstance(right != left))
+	default:
+		return typeMismatchError(op, left, right)
+	}
+}
+
+func (vm *VM) executeIntegerComparison(op opcodes.Opcode, left, right object.Object) error {
+	cmp := object.CompareIntegers(left, right)
+
+	switch op {
+	case opcodes.OpEqual:
+		return vm.push(toBooleanObjectInstance(cmp == 0))
+	case opcodes.OpNotEqual:
+		return vm.push(toBooleanObjectInstance(cmp != 0))
+	case opcodes.OpGreaterThan:
+		return vm.push(toBooleanObjectInstance(cmp > 0))
+	case opcodes.OpGreaterThanOrEqual:
+		return vm.push(toBooleanObjectInstance(cmp >= 0))
+	case opcodes.OpLessThan:
+		return vm.push(toBooleanObjectInstance(cmp < 0))
+	case opcodes.OpLessThanOrEqual:
+		return vm.push(toBooleanObjectInstance(cmp <= 0))
+	default:
+		return unknownOperatorError(op, left, right)
+	}
+}
+
+func (vm *VM) executeDecimalComparison(op opcodes.Opcode, left, right object.Object) error {
+	cmp := object.CompareDecimals(left, right)
+
+	switch op {
+	case opcodes.OpEqual:
+		return vm.push(toBooleanObjectInstance(cmp == 0))
+	case opcodes.OpNotEqual:
+		return vm.push(toBooleanObjectInstance(cmp != 0))
+	case opcodes.OpGreaterThan:
+		return vm.push(toBooleanObjectInstance(cmp > 0))
+	case opcodes.OpGreaterThanOrEqual:
+		return vm.push(toBooleanObjectInstance(cmp >= 0))
+	case opcodes.OpLessThan:
+		return vm.push(toBooleanObjectInstance(cmp < 0))
+	case opcodes.OpLessThanOrEqual:
+		return vm.push(toBooleanObjectInstance(cmp <= 0))
+	default:
+		return unknownOperatorError(op, left, right)
+	}
+}
+
+func (vm *VM) executeFloatComparison(op opcodes.Opcode, left, right object.Object) error {
+	leftValue := object.ToFloat(left)
+	rightValue := object.ToFloat(right)
+
+	switch op {
+	case opcodes.OpEqual:
+		return vm.push(toBooleanObjectInstance(rightValue == leftValue))
+	case opcodes.OpNotEqual:
+		return vm.push(toBooleanObjectInstance(rightValue != leftValue))
+	case opcodes.OpGreaterThan:
+		return vm.push(toBooleanObjectInstance(leftValue > rightValue))
+	case opcodes.OpGreaterThanOrEqual:
+		return vm.push(toBooleanObjectInstance(leftValue >= rightValue))
+	case opcodes.OpLessThan:
+		return vm.push(toBooleanObjectInstance(leftValue < rightValue))
+	case opcodes.OpLessThanOrEqual:
+		return vm.push(toBooleanObjectInstance(leftValue <= rightValue))
+	default:
+		return unknownOperatorError(op, left, right)
+	}
+}
+
+// executeStringComparison compares strings by value, they are not ordered
+func (vm *VM) executeStringComparison(op opcodes.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case opcodes.OpEqual:
+		return vm.push(toBooleanObjectInstance(leftValue == rightValue))
+	case opcodes.OpNotEqual:
+		return vm.push(toBooleanObjectInstance(leftValue != rightValue))
+	default:
+		return unknownOperatorError(op, left, right)
+	}
+}
+
+// operators maps the opcode of a binary operator back to its source operator, for the error messages
+var operators = map[opcodes.Opcode]string{
+	opcodes.OpAdd:                "+",
+	opcodes.OpSub:                "-",
+	opcodes.OpMul:                "*",
+	opcodes.OpDiv:                "/",
+	opcodes.OpMod:                "%",
+	opcodes.OpPow:                "**",
+	opcodes.OpBitAnd:             "&",
+	opcodes.OpBitOr:              "|",
+	opcodes.OpBitXor:             "^",
+	opcodes.OpShiftLeft:          "<<",
+	opcodes.OpShiftRight:         ">>",
+	opcodes.OpEqual:              "==",
+	opcodes.OpNotEqual:           "!=",
+	opcodes.OpGreaterThan:        ">",
+	opcodes.OpGreaterThanOrEqual: ">=",
+	opcodes.OpLessThan:           "<",
+	opcodes.OpLessThanOrEqual:    "<=",
+}
+
+// unknownOperatorError reports an operator the operand types do not support, worded as the evaluator does
+func unknownOperatorError(op opcodes.Opcode, left, right object.Object) error {
+	return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+}
+
+// typeMismatchError reports operands of different types, or an unknown operator when they have the same type
+func typeMismatchError(op opcodes.Opcode, left, right object.Object) error {
+	if left.Type() != right.Type() {
+		return fmt.Errorf("type mismatch: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+	return unknownOperatorError(op, left, right)
+}
+
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case True:
+		return vm.push(False)
+	case False:
+		return vm.push(True)
+	case Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	switch operand := operand.(type) {
+	case *object.Integer, *object.BigInt:
+		return vm.push(object.NegateInteger(operand))
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	case *object.Decimal:
+		return vm.push(object.NegateDecimal(operand))
+	default:
+		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
+	}
+}
+
+// buildArray makes an array out of the stack elements in [startIndex, endIndex)
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+// buildString joins the stack elements in [startIndex, endIndex) into a string, as they are inspected
+func (vm *VM) buildString(startIndex, endIndex int) object.Object {
+	var out strings.Builder
+
+	for i := startIndex; i < endIndex; i++ {
+		out.WriteString(vm.stack[i].Inspect())
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+// buildHash makes a hash out of the stack elements in [startIndex, endIndex), laid out as key, value, key, value...
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		pair := object.HashPair{Key: key, Value: value}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = pair
+	}
+
+	return &object.Hashes{Pairs: hashedPairs}, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrObj := array.(*object.Array)
+	idx := index.(*object.Integer).Value
+	max := int64(len(arrObj.Elements) - 1)
+
+	if idx < 0 || idx > max {
+		return vm.push(Null)
+	}
+
+	return vm.push(arrObj.Elements[idx])
+}
+
+// executeStringIndex indexes the chars of the string, not its bytes
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	chars := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+
+	if idx < 0 || idx >= int64(len(chars)) {
+		return vm.push(Null)
+	}
+
+	return vm.push(&object.String{Value: string(chars[idx])})
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObj := hash.(*object.Hashes)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObj.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
+// isTruthy mirrors evaluator.isTruthy, only null and false are not truthy
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true // handles if (n)
+	}
+}
+
+func toBooleanObjectInstance(value bool) *object.Boolean {
+	if value {
+		return True
+	}
+	return False
+}
@@ -2,6 +2,7 @@ package vm
 
 import (
 	"fmt"
+	"math/big"
 	"testing"
 
 	"github.com/seblkma/go-himeji/ast"
@@ -35,6 +36,32 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+	}
+
+	return nil
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	}
+
+	return nil
+}
+
 func testExpectedObject(t *testing.T, expected interface{}, actual object.Object) {
 	t.Helper()
 
@@ -44,6 +71,75 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 		if err != nil {
 			t.Errorf("testExpectedObject failed: %s", err)
 		}
+	case float64:
+		float, ok := actual.(*object.Float)
+		if !ok {
+			t.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+		} else if float.Value != exp {
+			t.Errorf("object has wrong value. got=%g, want=%g", float.Value, exp)
+		}
+	case *big.Int:
+		bigInt, ok := actual.(*object.BigInt)
+		if !ok {
+			t.Errorf("object is not BigInt. got=%T (%+v)", actual, actual)
+		} else if bigInt.Value.Cmp(exp) != 0 {
+			t.Errorf("object has wrong value. got=%s, want=%s", bigInt.Value, exp)
+		}
+	case bool:
+		err := testBooleanObject(exp, actual)
+		if err != nil {
+			t.Errorf("testExpectedObject failed: %s", err)
+		}
+	case string:
+		err := testStringObject(exp, actual)
+		if err != nil {
+			t.Errorf("testExpectedObject failed: %s", err)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(exp) {
+			t.Errorf("wrong num of elements. want=%d, got=%d", len(exp), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range exp {
+			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hashes)
+		if !ok {
+			t.Errorf("object is not Hash. got=%T (%+v)", actual, actual)
+			return
+		}
+
+		if len(hash.Pairs) != len(exp) {
+			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(exp), len(hash.Pairs))
+			return
+		}
+
+		for expectedKey, expectedValue := range exp {
+			pair, ok := hash.Pairs[expectedKey]
+			if !ok {
+				t.Errorf("no pair for given key in Pairs")
+			}
+
+			err := testIntegerObject(expectedValue, pair.Value)
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("object is not Null: %T (%+v)", actual, actual)
+		}
 	}
 }
 
@@ -58,13 +154,27 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 			t.Fatalf("compiler error: %s", err)
 		}
 
+		// Everything the compiler emits must pass the verifier
+		err = Verify(comp.ByteCode())
+		if err != nil {
+			t.Fatalf("verifier error: %s", err)
+		}
+
 		vm := New(comp.ByteCode())
 		err = vm.Run()
+
+		// An expected error is a runtime error of the VM, e.g. returned by a builtin
+		if exp, ok := tt.expected.(*object.Error); ok {
+			if err == nil || err.Error() != exp.Message {
+				t.Errorf("input %q: wrong VM error. want=%q, got=%v", tt.input, exp.Message, err)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatalf("vm error: %s", err)
 		}
 
-		stackElem := vm.StackTop()
+		stackElem := vm.LastPoppedStackElem()
 
 		testExpectedObject(t, tt.expected, stackElem)
 	}
@@ -75,8 +185,687 @@ func TestIntegerArithmetic(t *testing.T) {
 	tests := []vmTestCase{
 		{"1", 1},
 		{"2", 2},
-		{"1 + 2", 3}, // TODO: expected 3, but for now only has 2 at top of the stack
+		{"1 + 2", 3},
+		{"0xFF + 0o17 + 0b1 + 1_000", 1271},
+		{"1 - 2", -1},
+		{"1 * 2", 2},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-10", -10},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestBooleanExpressions
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"ab" != "a" + "b"`, false},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestConditionals
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if (true) { }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestGlobalLetStatements
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+		// redefining a name updates the variable, closures see the new value
+		{"let x = 1; let f = fn() { x }; let x = 2; f()", 2},
+		{"let g = fn() { let x = 1; let f = fn() { x }; let x = 2; f() }; g()", 2},
+		{"let g = fn(x) { let f = fn() { x }; let x = x + 1; f() }; g(5)", 6},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestStringExpressions
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"himeji"`, "himeji"},
+		{`"hime" + "ji"`, "himeji"},
+		{`"hime" + "ji" + " castle"`, "himeji castle"},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestArrayLiterals
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestHashLiterals
+func TestHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"{}", map[object.HashKey]int64{}},
+		{
+			"{1: 2, 2: 3}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 2,
+				(&object.Integer{Value: 2}).HashKey(): 3,
+			},
+		},
+		{
+			"{1 + 1: 2 * 2, 3 + 3: 4 * 4}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 2}).HashKey(): 4,
+				(&object.Integer{Value: 6}).HashKey(): 16,
+			},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestIndexExpressions
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][0 + 2]", 3},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1][-1]", Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+		{`{"one": 1}["o" + "ne"]`, 1},
+		// Equal numbers are the same key
+		{"{1: 5}[1.0]", 5},
+		{"{1: 5}[1.00d]", 5},
+		{"{2.0: 5}[2]", 5},
+		{"{1: 1, 1.0: 2, 1.0d: 3}[1]", 3},
+		{"{9223372036854775808: 5}[9223372036854775808.0]", 5},
+		{"{1.5: 5}[1.5d]", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestCallingFunctions
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let one = fn() { 1; }; let two = fn() { 2; }; one() + two()", 3},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; let c = fn() { b() + 1 }; c();", 3},
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let earlyExit = fn() { return 99; return 100; }; earlyExit();", 99},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let noReturn = fn() { }; let noReturnTwo = fn() { noReturn(); }; noReturn(); noReturnTwo();", Null},
+		{"let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();", 1},
+		{"return 10; 9;", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestCallingFunctionsWithBindings
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = fn() { let one = 1; one }; one();", 1},
+		{"let oneAndTwo = fn() { let one = 1; let two = 2; one + two; }; oneAndTwo();", 3},
+		{`
+		let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+		let threeAndFour = fn() { let three = 3; let four = 4; three + four; };
+		oneAndTwo() + threeAndFour();`, 10},
+		{`
+		let globalSeed = 50;
+		let minusOne = fn() { let num = 1; globalSeed - num; }
+		let minusTwo = fn() { let num = 2; globalSeed - num; }
+		minusOne() + minusTwo();`, 97},
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { a + b; }; sum(1, 2);", 3},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{`
+		let globalNum = 10;
+		let sum = fn(a, b) { let c = a + b; c + globalNum; };
+		let outer = fn() { sum(1, 2) + sum(3, 4) + globalNum; };
+		outer() + globalNum;`, 50},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestCallingFunctionsWithWrongArguments
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{`fn() { 1; }(1);`, `wrong number of arguments: want=0, got=1`},
+		{`fn(a) { a; }();`, `wrong number of arguments: want=1, got=0`},
+		{`fn(a, b) { a + b; }(1);`, `wrong number of arguments: want=2, got=1`},
+		{`1(2);`, `calling non-function`},
+		{`if (false) { let x = 1; }; x;`, `global 0 read before it was set`},
+		{`fn() { if (false) { let x = 1; }; x; }();`, `local 0 read before it was set`},
+		{`fn() { if (false) { let x = 1; }; let f = fn() { x }; f() }();`, `free variable 0 read before it was set`},
+		{`1 / 0`, `division by zero`},
+		{`9223372036854775807 * 2 / 0`, `division by zero`},
+		{`1.5d / 0`, `division by zero`},
+		{`1.5d + 1.5`, `type mismatch: DECIMAL + FLOAT`},
+		{`1 % 0`, `division by zero`},
+		{`"a" > "b"`, `unknown operator: STRING > STRING`},
+		{`"a" <= "b"`, `unknown operator: STRING <= STRING`},
+		{`1 << -1`, `negative shift count`},
+		{`1 + true`, `type mismatch: INTEGER + BOOLEAN`},
+		{`"a" >= true`, `type mismatch: STRING >= BOOLEAN`},
+		{`true + false`, `unknown operator: BOOLEAN + BOOLEAN`},
+		{`true < false`, `unknown operator: BOOLEAN < BOOLEAN`},
+		{`"a" - "b"`, `unknown operator: STRING - STRING`},
+		{`1.5 & 2`, `unknown operator: FLOAT & INTEGER`},
+		{`true && 1 / 0`, `division by zero`},
+		{`let s = "a"; s -= 1`, `type mismatch: STRING - INTEGER`},
+		{`let a = [1, 2]; a[2] = 3`, `index out of range: 2, array length 2`},
+		{`let a = [1, 2]; a[-1] = 0`, `index out of range: -1, array length 2`},
+		{`for (x in 5) { }`, `cannot iterate over INTEGER`},
+		{`for (x in 1..true) { }`, `range bounds must be INTEGER, got INTEGER and BOOLEAN`},
+		{`let s = "ab"; s[0] = "c"`, `index assignment not supported: STRING`},
+		{`let h = {}; h[[1]] = 1`, `unusable as hash key: ARRAY`},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.ByteCode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+// GOFLAGS="-count=1" go test -run TestClosures
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+		let newClosure = fn(a) { fn() { a; }; };
+		let closure = newClosure(99);
+		closure();`, 99},
+		{`
+		let newAdder = fn(a, b) { fn(c) { a + b + c }; };
+		let adder = newAdder(1, 2);
+		adder(8);`, 11},
+		{`
+		let newAdder = fn(a, b) { let c = a + b; fn(d) { c + d }; };
+		let adder = newAdder(1, 2);
+		adder(8);`, 11},
+		{`
+		let newAdderOuter = fn(a, b) {
+			let c = a + b;
+			fn(d) {
+				let e = d + c;
+				fn(f) { e + f; };
+			};
+		};
+		let newAdderInner = newAdderOuter(1, 2)
+		let adder = newAdderInner(3);
+		adder(8);`, 14},
+		{`
+		let a = 1;
+		let newAdderOuter = fn(b) {
+			fn(c) {
+				fn(d) { a + b + c + d };
+			};
+		};
+		let newAdderInner = newAdderOuter(2)
+		let adder = newAdderInner(3);
+		adder(8);`, 14},
+		{`
+		let newClosure = fn(a, b) {
+			let one = fn() { a; };
+			let two = fn() { b; };
+			fn() { one() + two(); };
+		};
+		let closure = newClosure(9, 90);
+		closure();`, 99},
+		{`
+		let callTwice = fn(f, x) { f(f(x)) };
+		callTwice(fn(x) { x * 2 }, 5);`, 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestRecursiveClosures
+func TestRecursiveClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+		let countDown = fn(x) {
+			if (x == 0) {
+				return 0;
+			} else {
+				countDown(x - 1);
+			}
+		};
+		countDown(1);`, 0},
+		{`
+		let wrapper = fn() {
+			let countDown = fn(x) {
+				if (x == 0) {
+					return 0;
+				} else {
+					countDown(x - 1);
+				}
+			};
+			countDown(1);
+		};
+		wrapper();`, 0},
+		{`
+		let fibonacci = fn(x) {
+			if (x == 0) {
+				return 0;
+			} else {
+				if (x == 1) {
+					return 1;
+				} else {
+					fibonacci(x - 1) + fibonacci(x - 2);
+				}
+			}
+		};
+		fibonacci(15);`, 610},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestBuiltinFunctions
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("guten tag!")`, 10},
+		{`len("こんにちは")`, 5},
+		{`len("Größe")`, 5},
+		{
+			`len(1)`,
+			&object.Error{Message: "argument to `len` not supported, got INTEGER"},
+		},
+		{
+			`len("one", "two")`,
+			&object.Error{Message: "wrong number of arguments. got=2, want=1"},
+		},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`print("hello", "world!")`, Null},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{
+			`first(1)`,
+			&object.Error{Message: "argument to `first` must be ARRAY or STRING, got INTEGER"},
+		},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, Null},
+		{`tail([1, 2, 3])`, []int{2, 3}},
+		{`tail([])`, Null},
+		{`first("日本語")`, "日"},
+		{`last("日本語")`, "語"},
+		{`tail("日本語")`, "本語"},
+		{`first("")`, Null},
+		{`push([1], 2)`, []int{1, 2}},
+		{`push([], 2)`, []int{2}},
+		{
+			`push(1, 1)`,
+			&object.Error{Message: "argument to `push` must be ARRAY, got INTEGER"},
+		},
+		{`len(1); 5`, &object.Error{Message: "argument to `len` not supported, got INTEGER"}},
+		{`let f = fn() { first(1); 5 }; f()`, &object.Error{Message: "argument to `first` must be ARRAY or STRING, got INTEGER"}},
+		{`let len = fn(x) { 42 }; len([])`, 42},
+		{`fn() { let xs = [1, 2]; len(xs) }()`, 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestRegisteredBuiltinFunctions
+func TestRegisteredBuiltinFunctions(t *testing.T) {
+	saved := object.Builtins
+	defer func() { object.Builtins = saved }()
+
+	_, err := object.RegisterBuiltin("double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+	if err != nil {
+		t.Fatalf("RegisterBuiltin failed: %s", err)
+	}
+
+	tests := []vmTestCase{
+		{`double(21)`, 42},
+		{`let twice = fn(x) { double(x) }; twice(4)`, 8},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestUnicode
+func TestUnicode(t *testing.T) {
+	tests := []vmTestCase{
+		{`"日本語"[0]`, "日"},
+		{`"Straße"[4]`, "ß"},
+		{`"Straße"[5]`, "e"},
+		{`"日本語"[3]`, Null},
+		{`"日本語"[-1]`, Null},
+		{`let 名前 = "ひめじ"; 名前 + "城"`, "ひめじ城"},
+		{`let größe2 = 3; größe2 * 2`, 6},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestInterpolatedStrings
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`let name = "Himeji"; "hello ${name}!"`, "hello Himeji!"},
+		{`let items = [1, 2]; "${len(items)} items: ${items}"`, "2 items: [1, 2]"},
+		{`"${1 + 1}${true}${if (false) { 1 }}"`, "2truenull"},
+		{`let f = fn(x) { "<${x}>" }; "${f("${f(1)}")}"`, "<<1>>"},
+		{`"${ {"a": 1}["a"] } \${x}"`, "1 ${x}"},
 	}
 
 	runVmTests(t, tests)
 }
+
+// GOFLAGS="-count=1" go test -run TestFloats
+func TestFloats(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"2.5e2", 250.0},
+		{"-0.5", -0.5},
+		{"1.5 + 1", 2.5},
+		{"1 + 1.5", 2.5},
+		{"10 / 4.0", 2.5},
+		{"10 / 4", 2},
+		{"0.1 * 3 - 0.3 < 0.000001", true},
+		{"2.0 == 2", true},
+		{"2 != 2.5", true},
+		{"1.5 > 1", true},
+		{"1 < 1.5", true},
+		{"1.0 / 0 > 1e308", true},
+		{"int(2.9)", 2},
+		{"int(-2.9)", -2},
+		{`int("42")`, 42},
+		{"float(1) / 3 * 3", 1.0},
+		{`float("6.5e1")`, 65.0},
+		{"float(2.5)", 2.5},
+		{`int("4.2")`, &object.Error{Message: `cannot convert "4.2" to INTEGER`}},
+		{"int(0.0 / 0)", &object.Error{Message: "cannot convert NaN to INTEGER"}},
+		{"float(true)", &object.Error{Message: "argument to `float` must be INTEGER, FLOAT, DECIMAL or STRING, got BOOLEAN"}},
+		{`"${1.0} ${0.25}"`, "1.0 0.25"},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestBigIntegers
+func TestBigIntegers(t *testing.T) {
+	tests := []vmTestCase{
+		{"9223372036854775807 + 1", bigInt("9223372036854775808")},
+		{"-9223372036854775807 - 2", bigInt("-9223372036854775809")},
+		{"4294967296 * 4294967296", bigInt("18446744073709551616")},
+		{"-(-9223372036854775807 - 1)", bigInt("9223372036854775808")},
+		{"(-9223372036854775807 - 1) / -1", bigInt("9223372036854775808")},
+		{"9223372036854775807 + 1 - 1", 9223372036854775807},
+		{"4294967296 * 4294967296 / 4294967296", 4294967296},
+		{"9223372036854775807 * 3 > 9223372036854775807", true},
+		{"-9223372036854775807 * 3 < 1", true},
+		{"9223372036854775807 + 1 == 4611686018427387904 * 2", true},
+		{"9223372036854775807 + 1 != 9223372036854775807 + 2", true},
+		{"9223372036854775807 * 2 + 0.5", 18446744073709551614.5},
+		{"int(1e20)", bigInt("100000000000000000000")},
+		{`int("-123456789012345678901234567890")`, bigInt("-123456789012345678901234567890")},
+		{"float(9223372036854775807 * 4)", 36893488147419103228.0},
+		{"{9223372036854775807 + 1: 1}[9223372036854775807 * 2 / 2 + 1]", 1},
+		{`"${9223372036854775807 + 1}"`, "9223372036854775808"},
+		{"9223372036854775808", bigInt("9223372036854775808")},
+		{"0xFFFF_FFFF_FFFF_FFFF", bigInt("18446744073709551615")},
+		{"-9223372036854775808", -9223372036854775808},
+		{"9223372036854775808 - 1", 9223372036854775807},
+		{"{18446744073709551616: 1}[1 << 64]", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestDecimals
+func TestDecimals(t *testing.T) {
+	tests := []vmTestCase{
+		{"0.1d + 0.2d == 0.3d", true},
+		{"1.50d == 1.5d", true},
+		{"1.50d != 1.51d", true},
+		{"2.5d > 2", true},
+		{"2 < 2.5d", true},
+		{`"${12.50d + 1}"`, "13.50"},
+		{`"${-(1 - 0.25d)}"`, "-0.75"},
+		{`"${19.99d * 3}"`, "59.97"},
+		{`"${10.00d / 4}"`, "2.50"},
+		{`"${1d / 3}"`, "0.3333333333333333333333333333"},
+		{`"${round(2.345d, 2)} ${round(2.345d, 2, "half_up")}"`, "2.34 2.35"},
+		{"scale(12.50d * 1.5d)", 3},
+		{"int(-12.9d)", -12},
+		{"float(12.5d)", 12.5},
+		{`{1.50d: "a"}[1.5d]`, "a"},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestOperators
+func TestOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7.5 % 2", 1.5},
+		{`"${10.5d % 3}"`, "1.5"},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"2 ** 64", bigInt("18446744073709551616")},
+		{"2 ** -1", 0.5},
+		{`"${1.5d ** 2} ${2d ** -2}"`, "2.25 0.25"},
+		{"12 & 10", 8},
+		{"12 | 10", 14},
+		{"12 ^ 10", 6},
+		{"1 << 10", 1024},
+		{"1 << 64", bigInt("18446744073709551616")},
+		{"-8 >> 1", -4},
+		{"(1 << 64) >> 60", 16},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 < 2", true},
+		{"2.5 < 1", false},
+		{"1.5d < 2d", true},
+		{"(1 << 64) <= 1", false},
+		// the left operand is evaluated first
+		{"let n = 0; let f = fn(x) { n = n * 10 + x; x }; f(1) < f(2); f(3) <= f(4); n", 1234},
+		{"1 >= 2", false},
+		{"1.5 >= 1.5", true},
+		{"1.50d <= 1.5d", true},
+		{"true && false", false},
+		{"true || false", true},
+		{`1 && "a"`, true},
+		{"false || 0", true},
+		{"false && 1 / 0", false},
+		{"true || 1 / 0", true},
+		{"let calls = fn(x) { [x] }; if (1 > 2 && calls(1)[0]) { 1 } else { 2 }", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestAssignments
+func TestAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 1; a = 2; a;", 2},
+		{"let a = 6; a *= 7; a;", 42},
+		{"let a = 1; a <<= 4; a |= 1; a;", 17},
+		{"let a = 1; if (true) { a = 2 }; a;", 2},
+		{"let total = 0; let add = fn(n) { total += n }; add(2); add(3); total;", 5},
+		{"let make = fn() { let c = 0; fn() { c += 1; c } }; let next = make(); next(); next(); next();", 3},
+		{"let make = fn() { let c = 0; fn() { c += 1; c } }; let a = make(); let b = make(); a(); a(); b();", 1},
+		{"let f = fn() { let c = 0; let inc = fn() { c += 1 }; inc(); inc(); c }; f();", 2},
+		{"let f = fn(n) { let g = fn() { fn() { n = n * 2 } }; g()(); g()(); n }; f(5);", 20},
+		{"let pair = fn() { let v = 0; [fn() { v += 1 }, fn() { v }] }; let p = pair(); p[0](); p[0](); p[1]();", 2},
+		{"let a = 1; let f = fn() { let a = 10; a += 1; a }; f() + a;", 12},
+		// the second call of f gets fresh locals, not the cell the first call shared with its closure
+		{"let f = fn(x) { let y = x; fn() { y } }; let a = f(1); let b = f(2); a() * 10 + b();", 12},
+		// a function refers to itself through its variable, which it can assign to
+		{"let f = fn() { f = 3; }; f(); f;", 3},
+		{"let f = fn() { f = 3; f }; f();", 3},
+		{"let g = fn() { let f = fn() { f = 4; 0 }; f(); f }; g();", 4},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; let g = f; f = fn(n) { 99 }; g(1);", 99},
+		{"let g = fn() { let f = fn(n) { if (n == 0) { 0 } else { n + f(n - 1) } }; f(4) }; g();", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestIndexAssignments
+func TestIndexAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2, 3]; a[1] = 20; a[1];", 20},
+		{"let a = [1, 2, 3]; a[2] *= 5; a[1 + 1];", 15},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"];`, 5},
+		{`let h = {"a": {"b": 1}}; h["a"]["b"] += 41; h["a"]["b"];`, 42},
+		{"let m = [[0, 0], [0, 0]]; m[1][0] = 7; m[1][0] + m[0][0];", 7},
+		// arrays and hashes are shared, not copied, as in the evaluator
+		{"let a = [1]; let b = a; b[0] = 2; a[0];", 2},
+		{"let a = [1]; let set = fn(arr) { arr[0] = 9 }; set(a); a[0];", 9},
+		{`let a = [1]; let h = {"a": a}; h["a"][0] = 3; a[0];`, 3},
+		{"let a = [1]; let b = push(a, 2); b[0] = 5; a[0];", 1},
+		// the array and the index are evaluated once
+		{"let n = 0; let a = [1, 2]; let f = fn() { n += 1; a }; f()[n] += 10; [n, a[1]];", []int{1, 12}},
+		{"let f = fn() { let a = [0]; a[0] += 1; a[0] }; f() + f();", 2},
+		// an array or a hash can contain itself, it is written as [...] when reached again
+		{`let a = [1]; a[0] = a; "${a}"`, "[[...]]"},
+		{`let h = {}; h["self"] = h; "${h}"`, "[self: [...]]"},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestLoops
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (i < 10) { i += 1 }; i;", 10},
+		{"let sum = 0; for (let i = 1; i <= 100; i += 1) { sum += i }; sum;", 5050},
+		{"let n = 0; for (let i = 0; i < 100000; i += 1) { n += 2 }; n;", 200000},
+		{"let i = 0; while (true) { i += 1; if (i == 5) { break } }; i;", 5},
+		{"let odd = 0; for (let i = 0; i < 10; i += 1) { if (i % 2 == 0) { continue }; odd += i }; odd;", 25},
+		{"let n = 0; for (let i = 0; i < 3; i += 1) { for (let j = 0; j < 3; j += 1) { if (j == i) { break }; n += 1 } }; n;", 3},
+		{"let i = 0; for (;;) { i += 1; if (i > 2) { break } }; i;", 3},
+		{"let i = 0; while (i < 3) { let j = i; i = j + 1; continue; i = 100 }; i;", 3},
+		{"let find = fn(arr, x) { for (let i = 0; i < len(arr); i += 1) { if (arr[i] == x) { return i } }; -1 }; find([5, 6, 7], 7) * 10 + find([1], 9);", 19},
+		{"let f = fn(n) { let total = 0; while (n > 0) { total += n; n -= 1 }; total }; f(4);", 10},
+		{"let a = [0, 0, 0]; for (let i = 0; i < len(a); i += 1) { a[i] = i * i }; a[2];", 4},
+		{"let f = fn() { let fs = [0, 0, 0]; for (let i = 0; i < 3; i += 1) { fs[i] = fn() { i } }; fs[0]() }; f();", 3},
+		{"let i = 0; while (false) { i = 1 }; i;", 0},
+	}
+
+	runVmTests(t, tests)
+}
+
+// GOFLAGS="-count=1" go test -run TestForInLoops
+func TestForInLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x }; sum;", 6},
+		{"let sum = 0; for (i, x in [10, 20, 30]) { sum += i * x }; sum;", 80},
+		{"let sum = 0; for (i in 1..100) { sum += i }; sum;", 5050},
+		{"let sum = 0; for (i in 0..<100) { sum += i }; sum;", 4950},
+		{"let n = 0; for (i in 5..1) { n += 1 }; n;", 0},
+		{"let n = 0; for (i in 3..3) { n += i }; n;", 3},
+		{"let n = 0; for (i in 0..1000000) { if (i == 3) { break }; n += 1 }; n;", 3},
+		{"let odd = 0; for (i in 0..<10) { if (i % 2 == 0) { continue }; odd += i }; odd;", 25},
+		{`let n = 0; for (c in "héllo") { n += 1 }; n;`, 5},
+		{`let s = 0; for (k, v in {"b": 2, "a": 1}) { s = s * 10 + v }; s;`, 12},
+		{`let s = 0; for (k, v in {3: 30, 1: 10, 2: 20}) { s = s * 10 + k }; s;`, 123},
+		{"let n = 0; for (i in 0..<3) { for (j in 0..<3) { if (j == i) { break }; n += 1 } }; n;", 3},
+		{"let last = 0; for (x in [7, 8, 9]) { last = x }; x * 100 + last;", 909},
+		{"let find = fn(arr, x) { for (i, v in arr) { if (v == x) { return i } }; -1 }; find([5, 6, 7], 7) * 10 + find([1], 9);", 19},
+		{"let a = [1, 2, 3]; for (i, x in a) { a[i] = x * x }; a[2];", 9},
+		{"let n = 0; let r = 1..4; for (i in r) { n += i }; for (i in r) { n += i }; n;", 20},
+		{"let f = fn() { let fs = [0, 0]; for (i in 0..1) { fs[i] = fn() { i } }; fs[0]() }; f();", 1},
+		{`let s = ""; for (c in "abc") { s = c + s }; s;`, "cba"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func bigInt(s string) *big.Int {
+	value, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("bad big integer " + s)
+	}
+	return value
+}